@@ -0,0 +1,290 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/strike-team/go-pingdom/pingdom"
+)
+
+// account is a Pingdom account scraped by the exporter. Its name labels the
+// metrics retrieved with its client, and is empty for the account given with
+// the positional arguments. The accounts authenticating with a bearer token
+// call the current Pingdom API, the others the legacy one.
+type account struct {
+	name      string
+	client    *pingdom.Client
+	tokenAuth bool
+}
+
+// The default base URLs of the Pingdom API, for the legacy username,
+// password and application key authentication and for the bearer token
+// authentication.
+const (
+	legacyAPIURL = "https://api.pingdom.com/api/2.1"
+	tokenAPIURL  = "https://api.pingdom.com/api/3.1"
+)
+
+// accountConfig holds the credentials of an account, as given in the
+// accounts list of the --config file. Accounts with an API token use the
+// bearer token authentication, ignoring the other credentials.
+type accountConfig struct {
+	Name         string `mapstructure:"name"`
+	Username     string `mapstructure:"username"`
+	Password     string `mapstructure:"password"`
+	APIKey       string `mapstructure:"api-key"`
+	AccountEmail string `mapstructure:"account-email"`
+	APIToken     string `mapstructure:"api-token"`
+}
+
+var accountFlags []string
+
+// accountFlagNames lists the flags added by addAccountFlags, the only ones
+// read again from the configuration on reload.
+var accountFlagNames = map[string]bool{}
+
+// addAccountFlags adds the flags configuring the accounts and the calls to
+// the Pingdom API to flags.
+func addAccountFlags(flags *pflag.FlagSet) {
+	fs := pflag.NewFlagSet("account", pflag.ContinueOnError)
+	fs.StringVar(&configFile, "config", "", "path to a YAML, TOML or JSON configuration file")
+	fs.IntVar(&scrapeTimeoutSeconds, "scrape-timeout", 30, "timeout (in seconds) of each call to the Pingdom API")
+	fs.IntVar(&maxRetries, "max-retries", 3, "maximum number of retries of the Pingdom API calls failing with a network or server error")
+	fs.StringVar(&apiURL, "api-url", legacyAPIURL, "base URL of the Pingdom API, "+tokenAPIURL+" by default with --api-token")
+	fs.StringVar(&apiToken, "api-token", "", "Pingdom API bearer token, used instead of the username, password and api-key")
+	fs.IntVar(&httpMaxIdleConnsPerHost, "http.max-idle-conns-per-host", 10, "maximum number of idle connections kept open to the Pingdom API")
+	fs.IntVar(&httpIdleConnTimeoutSeconds, "http.idle-conn-timeout", 90, "time (in seconds) after which the idle connections to the Pingdom API are closed")
+	fs.BoolVar(&httpDisableKeepAlives, "http.disable-keep-alives", false, "open a new connection for each call to the Pingdom API")
+	fs.BoolVar(&httpDisableHTTP2, "http.disable-http2", false, "call the Pingdom API with HTTP/1.1 only")
+	fs.Float64Var(&apiRateLimit, "api-rate-limit", 0, "maximum number of calls per second to the Pingdom API of each account, 0 for no limit")
+	fs.StringVar(&apiUserAgent, "api-user-agent", "pingdom_exporter/"+version.Version, "User-Agent header of the calls to the Pingdom API")
+	fs.IntVar(&pageLimit, "page-limit", 25000, "maximum number of checks retrieved per call to the Pingdom API")
+	fs.StringArrayVar(&accountFlags, "account", nil, "additional account to scrape, as name:api-token or name:username:password:api-key[:account-email] (repeatable)")
+	fs.StringVar(&userIDs, "user-ids", "", "only scrape the checks of these comma-separated user ids of a multi-user account")
+	fs.BoolVar(&includeTags, "include-tags", true, "retrieve the tags of the checks and transactions, exported in the tags label")
+	fs.StringVar(&tags, "tags", "", "only scrape checks and transactions having one of these comma-separated tags")
+	fs.StringVar(&tagsMatch, "tags-match", "any", "whether the checks and transactions must have any or all of the --tags")
+	fs.StringVar(&excludeFlag, "exclude-checks", "", "regular expression matching the names or hostnames of the checks not to scrape")
+
+	fs.VisitAll(func(f *pflag.Flag) {
+		accountFlagNames[f.Name] = true
+	})
+	flags.AddFlagSet(fs)
+}
+
+// setupAccounts returns the accounts of cmd, read from its flags, the
+// positional arguments and the configuration. The help is shown if no
+// account is configured.
+func setupAccounts(cmd *cobra.Command, args []string) []account {
+	accounts, err := buildAccounts(cmd, args, nil)
+	if err == errNoAccounts {
+		_ = cmd.Help()
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return accounts
+}
+
+// errNoAccounts is returned by buildAccounts when no account is configured.
+var errNoAccounts = errors.New("no account configured")
+
+// buildAccounts returns the accounts of cmd like setupAccounts, returning
+// the configuration errors instead of exiting so that it can be called
+// again on reload. Only the flags in only are read from the configuration,
+// or all of them if nil.
+func buildAccounts(cmd *cobra.Command, args []string, only map[string]bool) ([]account, error) {
+	config, err := loadConfig(cmd, only)
+	if err != nil {
+		return nil, err
+	}
+
+	accountConfigs, err := loadAccounts(config, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(accountConfigs) == 0 {
+		return nil, errNoAccounts
+	}
+
+	if err := validateAccountFlags(); err != nil {
+		return nil, err
+	}
+	if err := validateAccountAPIs(accountConfigs); err != nil {
+		return nil, err
+	}
+
+	var exclude *regexp.Regexp
+	if excludeFlag != "" {
+		if exclude, err = regexp.Compile(excludeFlag); err != nil {
+			return nil, fmt.Errorf("invalid --exclude-checks regular expression: %v", err)
+		}
+	}
+
+	transport := newHTTPTransport()
+	var accounts []account
+	for _, config := range accountConfigs {
+		acc, err := newAccount(config, transport)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+	excludeChecks = exclude
+
+	return accounts, nil
+}
+
+// reloadAccounts returns the accounts of cmd like buildAccounts, only
+// reading the account flags again from the configuration, as the other flags
+// are only applied on startup. The account flags are restored if the new
+// configuration is invalid.
+func reloadAccounts(cmd *cobra.Command, args []string) ([]account, error) {
+	saved := saveFlags(cmd.Flags(), accountFlagNames)
+	accounts, err := buildAccounts(cmd, args, accountFlagNames)
+	if err != nil {
+		restoreFlags(cmd.Flags(), saved)
+	}
+
+	return accounts, err
+}
+
+// newAccount returns the account for config, calling the Pingdom API with
+// next. Both authentications use pingdom.NewClientWithConfig, the bearer
+// token replacing the legacy credentials in tokenTransport as the library
+// only supports the latter.
+func newAccount(config accountConfig, next http.RoundTripper) (account, error) {
+	next = &rateLimitTransport{account: config.Name, next: next}
+	if apiRateLimit > 0 {
+		next = newThrottleTransport(config.Name, apiRateLimit, next)
+	}
+
+	var transport http.RoundTripper = &requestsTransport{account: config.Name, next: next}
+	baseURL := apiURL
+	if config.APIToken != "" {
+		transport = &tokenTransport{token: config.APIToken, next: transport}
+		if baseURL == legacyAPIURL {
+			baseURL = tokenAPIURL
+		}
+	}
+	if apiUserAgent != "" {
+		transport = &userAgentTransport{userAgent: apiUserAgent, next: transport}
+	}
+
+	client, err := pingdom.NewClientWithConfig(pingdom.ClientConfig{
+		User:         config.Username,
+		Password:     config.Password,
+		APIKey:       config.APIKey,
+		AccountEmail: config.AccountEmail,
+		BaseURL:      baseURL,
+		HTTPClient:   &http.Client{Transport: transport},
+	})
+	if err != nil {
+		return account{}, fmt.Errorf("error creating client for account %q: %v", config.Name, err)
+	}
+
+	return account{name: config.Name, client: client, tokenAuth: config.APIToken != ""}, nil
+}
+
+// loadAccounts returns the accounts given with --api-token or the positional
+// arguments, the --account flags and the accounts list of config, in this
+// order.
+func loadAccounts(config *viper.Viper, args []string) ([]accountConfig, error) {
+	var accounts []accountConfig
+
+	username := credential(config, args, 0, "username")
+	password := credential(config, args, 1, "password")
+	apiKey := credential(config, args, 2, "api-key")
+	if apiToken != "" {
+		accounts = append(accounts, accountConfig{APIToken: apiToken})
+	} else if username != "" || password != "" || apiKey != "" {
+		accounts = append(accounts, accountConfig{
+			Username:     username,
+			Password:     password,
+			APIKey:       apiKey,
+			AccountEmail: credential(config, args, 3, "account-email"),
+		})
+	}
+
+	for _, s := range accountFlags {
+		acc, err := parseAccount(s)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+
+	var configAccounts []accountConfig
+	if err := config.UnmarshalKey("accounts", &configAccounts); err != nil {
+		return nil, fmt.Errorf("invalid accounts in config file: %v", err)
+	}
+	accounts = append(accounts, configAccounts...)
+
+	names := map[string]bool{}
+	for _, acc := range accounts {
+		if acc.APIToken == "" && (acc.Username == "" || acc.Password == "" || acc.APIKey == "") {
+			return nil, fmt.Errorf("account %q is missing its api-token, or its username, password or api-key", acc.Name)
+		}
+		if names[acc.Name] {
+			if acc.Name == "" {
+				return nil, fmt.Errorf("accounts other than the positional arguments must be named")
+			}
+			return nil, fmt.Errorf("duplicate account %q", acc.Name)
+		}
+		names[acc.Name] = true
+	}
+
+	return accounts, nil
+}
+
+// parseAccount parses an --account flag of the form name:api-token or
+// name:username:password:api-key[:account-email]. The api-key and the
+// account-email, told apart by its @, are taken from the end so that the
+// password can contain a :, unlike the name and the username.
+func parseAccount(s string) (accountConfig, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 2 && len(fields) < 4 {
+		return accountConfig{}, fmt.Errorf("invalid account %q, must be name:api-token or name:username:password:api-key[:account-email]", fields[0])
+	}
+	if fields[0] == "" {
+		return accountConfig{}, fmt.Errorf("accounts given with --account must be named")
+	}
+
+	if len(fields) == 2 {
+		return accountConfig{Name: fields[0], APIToken: fields[1]}, nil
+	}
+
+	acc := accountConfig{Name: fields[0], Username: fields[1]}
+	if last := fields[len(fields)-1]; len(fields) > 4 && strings.Contains(last, "@") {
+		acc.AccountEmail = last
+		fields = fields[:len(fields)-1]
+	}
+	acc.APIKey = fields[len(fields)-1]
+	acc.Password = strings.Join(fields[2:len(fields)-1], ":")
+
+	return acc, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/prometheus/common/version"
+)
+
+func TestParseAccount(t *testing.T) {
+	tests := []struct {
+		flag    string
+		want    accountConfig
+		wantErr bool
+	}{
+		{"main:token", accountConfig{Name: "main", APIToken: "token"}, false},
+		{"main:user:pass:key", accountConfig{Name: "main", Username: "user", Password: "pass", APIKey: "key"}, false},
+		{"main:user:pass:key:owner@example.com", accountConfig{Name: "main", Username: "user", Password: "pass", APIKey: "key", AccountEmail: "owner@example.com"}, false},
+		{"main", accountConfig{}, true},
+		{"main:user:pass", accountConfig{}, true},
+		{"main:user:pa:ss:key", accountConfig{Name: "main", Username: "user", Password: "pa:ss", APIKey: "key"}, false},
+		{"main:user:pa:ss:key:owner@example.com", accountConfig{Name: "main", Username: "user", Password: "pa:ss", APIKey: "key", AccountEmail: "owner@example.com"}, false},
+		{"main:user:p@ss:key", accountConfig{Name: "main", Username: "user", Password: "p@ss", APIKey: "key"}, false},
+		{"main:user:a:b:c:key", accountConfig{Name: "main", Username: "user", Password: "a:b:c", APIKey: "key"}, false},
+		{":token", accountConfig{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAccount(tt.flag)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAccount(%q) error = %v, want error %v", tt.flag, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAccount(%q) = %+v, want %+v", tt.flag, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAccountsCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pingdom_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, `
+username: config-user
+password: config-pass
+api-key: config-key
+`)
+	env := map[string]string{
+		"PINGDOM_USERNAME":      "env-user",
+		"PINGDOM_PASSWORD":      "env-pass",
+		"PINGDOM_API_KEY":       "env-key",
+		"PINGDOM_ACCOUNT_EMAIL": "env@example.com",
+	}
+
+	tests := []struct {
+		name   string
+		env    bool
+		config bool
+		args   []string
+		want   []accountConfig
+	}{
+		{"none", false, false, nil, nil},
+		{"env only", true, false, nil, []accountConfig{
+			{Username: "env-user", Password: "env-pass", APIKey: "env-key", AccountEmail: "env@example.com"},
+		}},
+		{"args only", false, false, []string{"arg-user", "arg-pass", "arg-key"}, []accountConfig{
+			{Username: "arg-user", Password: "arg-pass", APIKey: "arg-key"},
+		}},
+		{"args over env", true, false, []string{"arg-user", "arg-pass", "arg-key", "arg@example.com"}, []accountConfig{
+			{Username: "arg-user", Password: "arg-pass", APIKey: "arg-key", AccountEmail: "arg@example.com"},
+		}},
+		{"missing args from env", true, false, []string{"arg-user", "arg-pass"}, []accountConfig{
+			{Username: "arg-user", Password: "arg-pass", APIKey: "env-key", AccountEmail: "env@example.com"},
+		}},
+		{"config only", false, true, nil, []accountConfig{
+			{Username: "config-user", Password: "config-pass", APIKey: "config-key"},
+		}},
+		{"env over config", true, true, []string{"arg-user"}, []accountConfig{
+			{Username: "arg-user", Password: "env-pass", APIKey: "env-key", AccountEmail: "env@example.com"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env {
+				for key, value := range env {
+					os.Setenv(key, value)
+					defer os.Unsetenv(key)
+				}
+			}
+
+			cmd, reset := newTestCommand()
+			defer reset()
+			if tt.config {
+				if err := cmd.Flags().Parse([]string{"--config", path}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config, err := loadConfig(cmd, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadAccounts(config, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("loadAccounts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccountUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"default", nil, "pingdom_exporter/" + version.Version},
+		{"custom", []string{"--api-user-agent", "acme-monitoring/1.0 (ops@example.com)"}, "acme-monitoring/1.0 (ops@example.com)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, reset := newTestCommand()
+			defer reset()
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			acc, cleanup := newTestAccountHandler(t, "user-agent", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("User-Agent")
+				fmt.Fprint(w, `{"checks": []}`)
+			}))
+			defer cleanup()
+
+			if _, err := listChecks(context.Background(), acc.client, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got User-Agent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
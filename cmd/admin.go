@@ -0,0 +1,83 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+// adminCheckPrefix is the path prefix of the admin endpoints of the checks,
+// /admin/check/<id>/pause and /admin/check/<id>/unpause.
+const adminCheckPrefix = "/admin/check/"
+
+// adminCheckHandler pauses or unpauses through the Pingdom API the check
+// whose id is given in the path, in the account given in the account query
+// parameter, the unnamed account by default. Only POST requests are
+// allowed, and the new state of the check is returned as JSON.
+func adminCheckHandler(currentAccounts func() []account) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, adminCheckPrefix), "/")
+		if len(parts) != 2 || (parts[1] != "pause" && parts[1] != "unpause") {
+			http.NotFound(w, r)
+			return
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid check id", http.StatusBadRequest)
+			return
+		}
+		paused := parts[1] == "pause"
+
+		name := r.URL.Query().Get("account")
+		acc := findAccount(currentAccounts(), name)
+		if acc == nil {
+			http.Error(w, fmt.Sprintf("Unknown account %q", name), http.StatusNotFound)
+			return
+		}
+
+		logger := log.With("account", acc.name).With("check", id).With("paused", paused).With("remote_addr", r.RemoteAddr)
+		if err := setCheckPaused(r.Context(), acc.client, id, paused); err != nil {
+			var apiErr *apiError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				http.Error(w, fmt.Sprintf("Check %d not found", id), http.StatusNotFound)
+				return
+			}
+
+			withRequest(logger, err).Errorln("Error updating check")
+			http.Error(w, "Error updating the check through the Pingdom API", http.StatusBadGateway)
+			return
+		}
+		logger.Infoln("Updated check through the admin API")
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Account string `json:"account"`
+			ID      int    `json:"id"`
+			Paused  bool   `json:"paused"`
+		}{acc.name, id, paused})
+	}
+}
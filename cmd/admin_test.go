@@ -0,0 +1,77 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminCheckHandler(t *testing.T) {
+	var updates []string
+	acc, cleanup := newTestAccountHandler(t, "admin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/checks/1":
+			updates = append(updates, r.Method+" paused="+r.FormValue("paused"))
+			fmt.Fprint(w, `{"message": "Modification of check was successful!"}`)
+		case "/checks/3":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error": {"statuscode": 500, "statusdesc": "Internal Server Error", "errormessage": "Internal error"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": {"statuscode": 404, "statusdesc": "Not Found", "errormessage": "Check not found"}}`)
+		}
+	}))
+	defer cleanup()
+	handler := adminCheckHandler(func() []account { return []account{acc} })
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		want     int
+		wantBody string
+		update   string
+	}{
+		{"pause", http.MethodPost, "/admin/check/1/pause?account=admin", http.StatusOK, `{"account":"admin","id":1,"paused":true}`, "PUT paused=true"},
+		{"unpause", http.MethodPost, "/admin/check/1/unpause?account=admin", http.StatusOK, `{"account":"admin","id":1,"paused":false}`, "PUT paused=false"},
+		{"get", http.MethodGet, "/admin/check/1/pause?account=admin", http.StatusMethodNotAllowed, "", ""},
+		{"unknown action", http.MethodPost, "/admin/check/1/stop?account=admin", http.StatusNotFound, "", ""},
+		{"invalid id", http.MethodPost, "/admin/check/web/pause?account=admin", http.StatusBadRequest, "", ""},
+		{"unknown account", http.MethodPost, "/admin/check/1/pause?account=other", http.StatusNotFound, "", ""},
+		{"unknown check", http.MethodPost, "/admin/check/2/pause?account=admin", http.StatusNotFound, "", ""},
+		{"api error", http.MethodPost, "/admin/check/3/pause?account=admin", http.StatusBadGateway, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates = nil
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rec.Code != tt.want {
+				t.Fatalf("got %d %q, want %d", rec.Code, rec.Body.String(), tt.want)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("got body %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := strings.Join(updates, ";"); got != tt.update {
+				t.Errorf("got updates %q, want %q", got, tt.update)
+			}
+		})
+	}
+}
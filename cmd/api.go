@@ -0,0 +1,569 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/strike-team/go-pingdom/pingdom"
+)
+
+// retryBackoff is the delay before the first retry of a failed call to the
+// Pingdom API, doubled on each subsequent retry. It is shortened by the
+// tests.
+var retryBackoff = time.Second
+
+// maxRetryAfter is the longest Retry-After of a 429 response waited for
+// before retrying, the call failing right away if Pingdom asks for more.
+const maxRetryAfter = time.Minute
+
+// apiError is the error returned when the Pingdom API responds with a non-2xx
+// status code. RetryAfter is the delay asked by the Retry-After header of a
+// 429 response, 0 if missing.
+type apiError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("HTTP %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+// requestError is the error returned by apiGet, holding the resource and the
+// parameters of the failed call for the logs.
+type requestError struct {
+	Resource string
+	Params   map[string]string
+	Err      error
+}
+
+func (e *requestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.Err
+}
+
+// withRequest returns logger with err and, when err is a requestError, the
+// resource and parameters of the failed call.
+func withRequest(logger log.Logger, err error) log.Logger {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		logger = logger.With("resource", reqErr.Resource)
+		if len(reqErr.Params) > 0 {
+			params := make([]string, 0, len(reqErr.Params))
+			for k, v := range reqErr.Params {
+				params = append(params, k+"="+v)
+			}
+			sort.Strings(params)
+			logger = logger.With("params", strings.Join(params, " "))
+		}
+	}
+
+	return logger.With("err", err)
+}
+
+// apiGet calls the rsc resource of the Pingdom API and decodes the response
+// into v. The call is cancelled after the scrape timeout, and its errors are
+// returned as requestError.
+func apiGet(ctx context.Context, client *pingdom.Client, rsc string, params map[string]string, v interface{}) error {
+	return apiCall(ctx, client, "GET", rsc, params, v)
+}
+
+// apiPut updates the rsc resource of the Pingdom API like apiGet.
+func apiPut(ctx context.Context, client *pingdom.Client, rsc string, params map[string]string, v interface{}) error {
+	return apiCall(ctx, client, "PUT", rsc, params, v)
+}
+
+// apiCall implements apiGet and apiPut.
+func apiCall(ctx context.Context, client *pingdom.Client, method, rsc string, params map[string]string, v interface{}) error {
+	if err := doCall(ctx, client, method, rsc, params, v); err != nil {
+		return &requestError{Resource: rsc, Params: params, Err: err}
+	}
+
+	return nil
+}
+
+// doCall implements apiCall.
+func doCall(ctx context.Context, client *pingdom.Client, method, rsc string, params map[string]string, v interface{}) error {
+	req, err := client.NewRequest(method, rsc, params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(scrapeTimeoutSeconds))
+	defer cancel()
+	ctx = context.WithValue(ctx, endpointKey{}, endpoint(rsc))
+
+	resp, err := client.Do(req.WithContext(ctx), v)
+	if err != nil && resp != nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		apiErr := &apiError{StatusCode: resp.StatusCode, Err: err}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			apiErr.RetryAfter = retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return apiErr
+	}
+	return err
+}
+
+// retryAfter returns the delay of a Retry-After header, given in seconds or
+// as an HTTP date, from now. It returns 0 if the header is missing or
+// malformed.
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// endpointKey is the context key of the endpoint of a call to the Pingdom
+// API, counted by requestsTransport.
+type endpointKey struct{}
+
+// endpoint returns the endpoint of the rsc resource, its first path segment,
+// e.g. checks for /checks/123.
+func endpoint(rsc string) string {
+	return strings.SplitN(strings.TrimPrefix(rsc, "/"), "/", 2)[0]
+}
+
+// isRetryable returns whether err is a network error, a server error or a
+// rate limiting error, which may not happen again on a subsequent call.
+func isRetryable(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isAuthError returns whether err is an authentication or authorization
+// error, e.g. because of wrong credentials.
+func isAuthError(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden
+	}
+
+	return false
+}
+
+// errorClass returns the class of err counted by pingdom_scrape_errors_total:
+// timeout, auth, rate_limited, http_5xx, decode, network or other.
+func errorClass(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case isAuthError(err):
+			return "auth"
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return "rate_limited"
+		case apiErr.StatusCode >= 500:
+			return "http_5xx"
+		default:
+			return "other"
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return "decode"
+	}
+
+	if errors.As(err, &netErr) {
+		return "network"
+	}
+
+	return "other"
+}
+
+// withRetries calls f until it succeeds, up to maxRetries times after the
+// first call, with an exponential backoff between calls, or after the
+// Retry-After of the rate limited calls. Only the retryable errors are
+// retried.
+func withRetries(ctx context.Context, f func() error) error {
+	backoff := retryBackoff
+	for retry := 0; ; retry++ {
+		err := f()
+		if err == nil || retry >= maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		wait := backoff
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			if apiErr.RetryAfter > maxRetryAfter {
+				withRequest(log.With("retry_after", apiErr.RetryAfter), err).Warnln("Not retrying rate limited call to the Pingdom API")
+				return err
+			}
+			wait = apiErr.RetryAfter
+		}
+
+		withRequest(log.With("retry", retry+1), err).Warnln("Retrying failed call to the Pingdom API")
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// checkResponse extends pingdom.CheckResponse with the fields returned by
+// the checks endpoint that the Pingdom library doesn't decode.
+type checkResponse struct {
+	pingdom.CheckResponse
+	LastModified  int64 `json:"lastmodified,omitempty"`
+	LastProbeID   int   `json:"lastprobeid,omitempty"`
+	LastDownStart int64 `json:"lastdownstart,omitempty"`
+	LastDownEnd   int64 `json:"lastdownend,omitempty"`
+}
+
+// listChecks returns the list of checks from Pingdom, like
+// client.Checks.List, but decoded into checkResponse.
+func listChecks(ctx context.Context, client *pingdom.Client, params map[string]string) ([]checkResponse, error) {
+	m := &struct {
+		Checks []checkResponse `json:"checks"`
+	}{}
+	if err := apiGet(ctx, client, "/checks", params, m); err != nil {
+		return nil, err
+	}
+
+	return m.Checks, nil
+}
+
+// listAllChecks returns all the checks from Pingdom, retrieving them by
+// pages of pageLimit checks. Each page is retried on its own.
+func listAllChecks(ctx context.Context, client *pingdom.Client, params map[string]string) ([]checkResponse, error) {
+	var checks []checkResponse
+	for offset := 0; ; offset += pageLimit {
+		pageParams := map[string]string{
+			"limit":  strconv.Itoa(pageLimit),
+			"offset": strconv.Itoa(offset),
+		}
+		for k, v := range params {
+			pageParams[k] = v
+		}
+
+		var page []checkResponse
+		err := withRetries(ctx, func() (err error) {
+			page, err = listChecks(ctx, client, pageParams)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, page...)
+		if len(page) < pageLimit {
+			return checks, nil
+		}
+	}
+}
+
+// getCheck returns the details of the check with the given id, like
+// client.Checks.Read.
+func getCheck(ctx context.Context, client *pingdom.Client, id int) (*checkResponse, error) {
+	m := &struct {
+		Check checkResponse `json:"check"`
+	}{}
+	if err := apiGet(ctx, client, "/checks/"+strconv.Itoa(id), nil, m); err != nil {
+		return nil, err
+	}
+
+	return &m.Check, nil
+}
+
+// setCheckPaused pauses or unpauses the check with the given id, like
+// client.Checks.Update with only the paused parameter.
+func setCheckPaused(ctx context.Context, client *pingdom.Client, id int, paused bool) error {
+	params := map[string]string{"paused": strconv.FormatBool(paused)}
+	m := &struct {
+		Message string `json:"message"`
+	}{}
+
+	return apiPut(ctx, client, "/checks/"+strconv.Itoa(id), params, m)
+}
+
+// getCheckJSON returns the check with the given id from Pingdom as the raw
+// JSON returned by the API, with all its fields.
+func getCheckJSON(ctx context.Context, client *pingdom.Client, id int) (json.RawMessage, error) {
+	m := &struct {
+		Check json.RawMessage `json:"check"`
+	}{}
+	if err := apiGet(ctx, client, "/checks/"+strconv.Itoa(id), nil, m); err != nil {
+		return nil, err
+	}
+
+	return m.Check, nil
+}
+
+// transactionResponse extends pingdom.TmsResponse with the fields returned
+// by the transactions endpoint that the Pingdom library doesn't decode.
+type transactionResponse struct {
+	pingdom.TmsResponse
+	LastResponseTime int64 `json:"lastresponsetime,omitempty"`
+}
+
+// listTransactions returns the transactions from Pingdom, like
+// client.Tms.List, but decoded into transactionResponse.
+func listTransactions(ctx context.Context, client *pingdom.Client, params map[string]string) (map[int]transactionResponse, error) {
+	m := &struct {
+		Tms map[int]transactionResponse `json:"recipes"`
+	}{}
+	if err := apiGet(ctx, client, "/tms.recipes", params, m); err != nil {
+		return nil, err
+	}
+
+	return m.Tms, nil
+}
+
+// transactionCheck is a transaction returned by the transaction checks
+// endpoint of the current Pingdom API.
+type transactionCheck struct {
+	ID        int                        `json:"id"`
+	Name      string                     `json:"name"`
+	Active    bool                       `json:"active"`
+	Status    string                     `json:"status"`
+	Region    string                     `json:"region"`
+	Interval  int                        `json:"interval"`
+	CreatedAt int64                      `json:"created_at"`
+	Tags      []pingdom.CheckResponseTag `json:"tags"`
+}
+
+// transactionChecksPageLimit is the maximum number of transactions returned
+// per call to the transaction checks endpoint.
+const transactionChecksPageLimit = 1000
+
+// listTransactionChecks returns the transactions from the transaction checks
+// endpoint of the current Pingdom API, which replaces the transactions
+// endpoint of the legacy API. They are converted to the transactionResponse
+// of the latter, with its upper-case status and YES or NO activity, but
+// without their response time as this endpoint doesn't return it.
+func listTransactionChecks(ctx context.Context, client *pingdom.Client, params map[string]string) (map[int]transactionResponse, error) {
+	query := map[string]string{
+		"extended_tags": "true",
+		"limit":         strconv.Itoa(transactionChecksPageLimit),
+	}
+	if params["tags"] != "" {
+		query["tags"] = params["tags"]
+	}
+
+	transactions := map[int]transactionResponse{}
+	for offset := 0; ; offset += transactionChecksPageLimit {
+		query["offset"] = strconv.Itoa(offset)
+		m := &struct {
+			Checks []transactionCheck `json:"checks"`
+		}{}
+		if err := apiGet(ctx, client, "/tms/check", query, m); err != nil {
+			return nil, err
+		}
+
+		for _, check := range m.Checks {
+			active := "NO"
+			if check.Active {
+				active = "YES"
+			}
+
+			tms := transactionResponse{TmsResponse: pingdom.TmsResponse{
+				Name:      check.Name,
+				Status:    strings.ToUpper(check.Status),
+				Kitchen:   check.Region,
+				Active:    active,
+				CreatedAt: check.CreatedAt,
+				Interval:  check.Interval,
+			}}
+			if params["include_tags"] != "false" {
+				tms.Tags = check.Tags
+			}
+			transactions[check.ID] = tms
+		}
+
+		if len(m.Checks) < transactionChecksPageLimit {
+			return transactions, nil
+		}
+	}
+}
+
+// transactionStep is a step of a transaction.
+type transactionStep struct {
+	Fn string `json:"fn"`
+}
+
+// getTransactionSteps returns the steps of the transaction with the given id
+// from the transaction check endpoint of the current Pingdom API.
+func getTransactionSteps(ctx context.Context, client *pingdom.Client, id int) ([]transactionStep, error) {
+	m := &struct {
+		Steps []transactionStep `json:"steps"`
+	}{}
+	if err := apiGet(ctx, client, "/tms/check/"+strconv.Itoa(id), nil, m); err != nil {
+		return nil, err
+	}
+
+	return m.Steps, nil
+}
+
+// transactionState is a state of a transaction in its status report.
+type transactionState struct {
+	Status      string `json:"status"`
+	ErrorInStep int    `json:"error_in_step"`
+	Message     string `json:"message"`
+}
+
+// getTransactionStates returns the states of the transaction with the given
+// id from the status report of the current Pingdom API, oldest first.
+func getTransactionStates(ctx context.Context, client *pingdom.Client, id int) ([]transactionState, error) {
+	m := &struct {
+		Report struct {
+			States []transactionState `json:"states"`
+		} `json:"report"`
+	}{}
+	if err := apiGet(ctx, client, "/tms/check/"+strconv.Itoa(id)+"/report/status", nil, m); err != nil {
+		return nil, err
+	}
+
+	return m.Report.States, nil
+}
+
+// getResults returns the raw test results of the check with the given id,
+// like client.Checks.Results.
+func getResults(ctx context.Context, client *pingdom.Client, id int, params map[string]string) (*pingdom.ResultsResponse, error) {
+	m := &pingdom.ResultsResponse{}
+	if err := apiGet(ctx, client, "/results/"+strconv.Itoa(id), params, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// listProbes returns the probe servers from Pingdom, like
+// client.Probes.List.
+func listProbes(ctx context.Context, client *pingdom.Client, params map[string]string) ([]pingdom.ProbeResponse, error) {
+	m := &struct {
+		Probes []pingdom.ProbeResponse `json:"probes"`
+	}{}
+	if err := apiGet(ctx, client, "/probes", params, m); err != nil {
+		return nil, err
+	}
+
+	return m.Probes, nil
+}
+
+// listMaintenance returns the maintenance windows from Pingdom, like
+// client.Maintenances.List.
+func listMaintenance(ctx context.Context, client *pingdom.Client) ([]pingdom.MaintenanceResponse, error) {
+	m := &struct {
+		Maintenance []pingdom.MaintenanceResponse `json:"maintenance"`
+	}{}
+	if err := apiGet(ctx, client, "/maintenance", nil, m); err != nil {
+		return nil, err
+	}
+
+	return m.Maintenance, nil
+}
+
+// listUsers returns the users of the account of client, like
+// client.Users.List.
+func listUsers(ctx context.Context, client *pingdom.Client) ([]pingdom.UsersResponse, error) {
+	m := &struct {
+		Users []pingdom.UsersResponse `json:"users"`
+	}{}
+	if err := apiGet(ctx, client, "/users", nil, m); err != nil {
+		return nil, err
+	}
+
+	return m.Users, nil
+}
+
+// credits is the account usage returned by the Pingdom credits endpoint.
+type credits struct {
+	CheckLimit      int `json:"checklimit"`
+	AvailableChecks int `json:"availablechecks"`
+}
+
+// getCredits returns the usage of the account of client.
+func getCredits(ctx context.Context, client *pingdom.Client) (*credits, error) {
+	m := &struct {
+		Credits credits `json:"credits"`
+	}{}
+	if err := apiGet(ctx, client, "/credits", nil, m); err != nil {
+		return nil, err
+	}
+
+	return &m.Credits, nil
+}
+
+// summaryAverage is the summary returned by the Pingdom summary.average
+// endpoint.
+type summaryAverage struct {
+	Status struct {
+		TotalUp   int64 `json:"totalup"`
+		TotalDown int64 `json:"totaldown"`
+	} `json:"status"`
+}
+
+// getSummaryAverage returns the average uptime of the check with the given
+// id.
+func getSummaryAverage(ctx context.Context, client *pingdom.Client, id int, params map[string]string) (*summaryAverage, error) {
+	m := &struct {
+		Summary summaryAverage `json:"summary"`
+	}{}
+	if err := apiGet(ctx, client, "/summary.average/"+strconv.Itoa(id), params, m); err != nil {
+		return nil, err
+	}
+
+	return &m.Summary, nil
+}
+
+// getSummaryPerformance returns the performance summary of the check with
+// the given id.
+func getSummaryPerformance(ctx context.Context, client *pingdom.Client, id int, params map[string]string) (*pingdom.SummaryPerformanceMap, error) {
+	m := &pingdom.SummaryPerformanceResponse{}
+	if err := apiGet(ctx, client, "/summary.performance/"+strconv.Itoa(id), params, m); err != nil {
+		return nil, err
+	}
+
+	return &m.Summary, nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(2 * time.Minute).Format(http.TimeFormat), 2 * time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.header, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	var syntaxErr error = &json.SyntaxError{}
+	var typeErr error = &json.UnmarshalTypeError{}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("get checks: %w", context.DeadlineExceeded), "timeout"},
+		{&net.DNSError{IsTimeout: true}, "timeout"},
+		{&apiError{StatusCode: http.StatusUnauthorized, Err: errors.New("unauthorized")}, "auth"},
+		{&apiError{StatusCode: http.StatusForbidden, Err: errors.New("forbidden")}, "auth"},
+		{&requestError{Resource: "/checks", Err: &apiError{StatusCode: http.StatusTooManyRequests, Err: errors.New("rate limited")}}, "rate_limited"},
+		{&apiError{StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}, "http_5xx"},
+		{&apiError{StatusCode: http.StatusNotFound, Err: errors.New("not found")}, "other"},
+		{syntaxErr, "decode"},
+		{fmt.Errorf("decode: %w", typeErr), "decode"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{errors.New("boom"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestListAllChecksPages(t *testing.T) {
+	defer func(limit int) { pageLimit = limit }(pageLimit)
+	pageLimit = 2
+
+	tests := []struct {
+		name    string
+		checks  int
+		offsets string
+	}{
+		{"no checks", 0, "0"},
+		{"one partial page", 1, "0"},
+		{"full and partial pages", 3, "0,2"},
+		{"full pages", 4, "0,2,4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var offsets []string
+			acc, cleanup := newTestAccountHandler(t, "pages", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+				offsets = append(offsets, strconv.Itoa(offset))
+
+				var checks []string
+				for id := offset + 1; id <= tt.checks && id <= offset+limit; id++ {
+					checks = append(checks, fmt.Sprintf(`{"id": %d, "name": "check-%d"}`, id, id))
+				}
+				fmt.Fprintf(w, `{"checks": [%s]}`, strings.Join(checks, ","))
+			}))
+			defer cleanup()
+
+			checks, err := listAllChecks(context.Background(), acc.client, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(offsets, ","); got != tt.offsets {
+				t.Errorf("got offsets %s, want %s", got, tt.offsets)
+			}
+			if len(checks) != tt.checks {
+				t.Fatalf("got %d checks, want %d", len(checks), tt.checks)
+			}
+			for i, check := range checks {
+				if check.ID != i+1 {
+					t.Errorf("got check %d at %d, want %d", check.ID, i, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestRetrieveChecksMetricsRetries(t *testing.T) {
+	defer func(backoff time.Duration, retries int) { retryBackoff, maxRetries = backoff, retries }(retryBackoff, maxRetries)
+	retryBackoff = time.Millisecond
+	maxRetries = 3
+
+	tests := []struct {
+		name       string
+		failures   int
+		status     int
+		retryAfter string
+		calls      int
+		wantErr    bool
+		minElapsed time.Duration
+	}{
+		{"success", 0, http.StatusInternalServerError, "", 1, false, 0},
+		{"fails twice", 2, http.StatusInternalServerError, "", 3, false, 0},
+		{"gives up", 10, http.StatusBadGateway, "", 4, true, 0},
+		{"client error", 10, http.StatusBadRequest, "", 1, true, 0},
+		{"retry after", 1, http.StatusTooManyRequests, "1", 2, false, time.Second},
+		{"retry after too long", 10, http.StatusTooManyRequests, "120", 1, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			acc, cleanup := newTestAccountHandler(t, "retries", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(tt.status)
+					fmt.Fprintf(w, `{"error": {"statuscode": %d, "statusdesc": "Error", "errormessage": "Error"}}`, tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"checks": [{"id": 1, "name": "web", "hostname": "example.com", "status": "up"}]}`)
+			}))
+			defer cleanup()
+
+			start := time.Now()
+			_, err := retrieveChecksMetrics(context.Background(), acc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retrieveChecksMetrics() error = %v, want error %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("got %d calls, want %d", calls, tt.calls)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("got the retry after %v, want it after %v", elapsed, tt.minElapsed)
+			}
+
+			want := map[string]float64{"endpoint=checks": 1}
+			if tt.wantErr {
+				want["endpoint=checks"] = 0
+			}
+			if got := series(pingdomUp, acc.name); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got pingdom_up %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRetrieveChecksMetricsTimeout(t *testing.T) {
+	defer func(timeout, retries int) { scrapeTimeoutSeconds, maxRetries = timeout, retries }(scrapeTimeoutSeconds, maxRetries)
+	scrapeTimeoutSeconds = 1
+	maxRetries = 0
+
+	done := make(chan struct{})
+	defer close(done)
+	acc, cleanup := newTestAccountHandler(t, "timeout", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		case <-done:
+		}
+		fmt.Fprint(w, `{"checks": []}`)
+	}))
+	defer cleanup()
+
+	start := time.Now()
+	_, err := retrieveChecksMetrics(context.Background(), acc)
+	if err == nil {
+		t.Fatal("retrieveChecksMetrics() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("got the call cancelled after %v, want it after the 1s --scrape-timeout", elapsed)
+	}
+
+	tests := []struct {
+		metric prometheus.Collector
+		want   map[string]float64
+	}{
+		{pingdomUp, map[string]float64{"endpoint=checks": 0}},
+		{pingdomScrapeErrors, map[string]float64{"class=timeout,endpoint=checks": 1}},
+	}
+	for _, tt := range tests {
+		if got := series(tt.metric, acc.name); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("got series %v, want %v", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import "sync"
+
+// maxBaselineWindow bounds --response-time-baseline-window, and so the
+// memory used by the baselines.
+const maxBaselineWindow = 1000
+
+// checkKey identifies a check across the accounts.
+type checkKey struct {
+	account string
+	id      int
+}
+
+// baselineSamples are the last response times of a check, oldest first,
+// and the time of the test of the last one.
+type baselineSamples struct {
+	values   []float64
+	lastTest int64
+}
+
+// baselines keeps the last response times of the checks in memory, to
+// compare their current response time with their average over the window
+// last tests. They are lost when the exporter restarts.
+type baselines struct {
+	mutex   sync.Mutex
+	samples map[checkKey]*baselineSamples
+}
+
+func newBaselines() *baselines {
+	return &baselines{samples: map[checkKey]*baselineSamples{}}
+}
+
+// responseTimeBaselines are the baselines of the response time of the
+// checks, with --response-time-baseline-window.
+var responseTimeBaselines = newBaselines()
+
+// update records the response time of the check with the given id of
+// account, tested at lastTest. It returns the average of the response times
+// of up to window previous tests, or false if there is none. The
+// response time of a test already recorded, as when the check wasn't tested
+// again since the previous scrape, isn't recorded twice.
+func (b *baselines) update(account string, id int, responseTime float64, lastTest int64, window int) (float64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	key := checkKey{account: account, id: id}
+	s, ok := b.samples[key]
+	if !ok {
+		s = &baselineSamples{}
+		b.samples[key] = s
+	}
+
+	previous := s.values
+	if len(previous) > 0 && lastTest == s.lastTest {
+		previous = previous[:len(previous)-1]
+	}
+	if len(previous) > window {
+		previous = previous[len(previous)-window:]
+	}
+
+	var baseline float64
+	for _, v := range previous {
+		baseline += v
+	}
+	if len(previous) > 0 {
+		baseline /= float64(len(previous))
+	}
+
+	if lastTest != s.lastTest || len(s.values) == 0 {
+		s.values = append(s.values, responseTime)
+		if len(s.values) > window+1 {
+			s.values = append(s.values[:0], s.values[len(s.values)-window-1:]...)
+		}
+		s.lastTest = lastTest
+	}
+
+	return baseline, len(previous) > 0
+}
+
+// prune drops the response times of the checks of account whose ids aren't
+// in ids, e.g. deleted or paused ones.
+func (b *baselines) prune(account string, ids map[int]bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for key := range b.samples {
+		if key.account == account && !ids[key.id] {
+			delete(b.samples, key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import "testing"
+
+func TestBaselinesUpdate(t *testing.T) {
+	b := newBaselines()
+
+	tests := []struct {
+		responseTime float64
+		lastTest     int64
+		want         float64
+		ok           bool
+	}{
+		{100, 1, 0, false},
+		{200, 2, 100, true},
+		// Not tested again since the previous update.
+		{200, 2, 100, true},
+		{300, 3, 150, true},
+		// Only the window last tests are averaged.
+		{400, 4, 250, true},
+		{500, 5, 350, true},
+	}
+	for i, tt := range tests {
+		got, ok := b.update("main", 1, tt.responseTime, tt.lastTest, 2)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("update #%d = %v, %v, want %v, %v", i, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if _, ok := b.update("other", 1, 100, 5, 2); ok {
+		t.Errorf("update of another account's check = true, want false")
+	}
+
+	b.prune("main", map[int]bool{2: true})
+	if _, ok := b.update("main", 1, 600, 6, 2); ok {
+		t.Errorf("update of a pruned check = true, want false")
+	}
+	if _, ok := b.update("other", 1, 200, 6, 2); !ok {
+		t.Errorf("update of another account's check after prune = false, want true")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"time"
+)
+
+// breaker is the circuit breaker of an account. It opens after
+// circuitBreakerThreshold consecutive failed scrapes, the account not being
+// scraped for circuitBreakerSeconds, after which a single scrape probes
+// whether the Pingdom API recovered, closing it on success.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	last      scrapeResult
+}
+
+// isOpen returns whether the scrapes of the account are skipped at now.
+func (b *breaker) isOpen(now time.Time) bool {
+	return now.Before(b.openUntil)
+}
+
+// record records the result of a scrape at now, and returns whether the
+// breaker is open.
+func (b *breaker) record(result scrapeResult, now time.Time) bool {
+	b.last = result
+	if result.ok {
+		b.failures = 0
+		return false
+	}
+
+	b.failures++
+	if circuitBreakerThreshold <= 0 || b.failures < circuitBreakerThreshold {
+		return false
+	}
+
+	b.openUntil = now.Add(time.Second * time.Duration(circuitBreakerSeconds))
+	return true
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerRecord(t *testing.T) {
+	previousThreshold, previousSeconds := circuitBreakerThreshold, circuitBreakerSeconds
+	defer func() { circuitBreakerThreshold, circuitBreakerSeconds = previousThreshold, previousSeconds }()
+	circuitBreakerSeconds = 60
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ok, failed := scrapeResult{ok: true}, scrapeResult{}
+
+	tests := []struct {
+		name      string
+		threshold int
+		results   []scrapeResult
+		want      bool
+	}{
+		{"disabled", 0, []scrapeResult{failed, failed, failed, failed}, false},
+		{"below threshold", 3, []scrapeResult{failed, failed}, false},
+		{"threshold", 3, []scrapeResult{failed, failed, failed}, true},
+		{"success resets", 3, []scrapeResult{failed, failed, ok, failed, failed}, false},
+		{"success", 1, []scrapeResult{ok}, false},
+		{"single failure", 1, []scrapeResult{failed}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuitBreakerThreshold = tt.threshold
+
+			var b breaker
+			var open bool
+			for _, result := range tt.results {
+				open = b.record(result, now)
+			}
+			if open != tt.want {
+				t.Errorf("record() = %v, want %v", open, tt.want)
+			}
+			if b.isOpen(now) != tt.want {
+				t.Errorf("isOpen() = %v, want %v", b.isOpen(now), tt.want)
+			}
+			if b.isOpen(now.Add(time.Minute)) {
+				t.Errorf("isOpen() after --circuit-breaker-duration = true, want false")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// checkInterval is the minimum interval between two calls to the /check
+// endpoint, which calls the Pingdom API on each request.
+const checkInterval = time.Second
+
+// checkHandler returns the details of the check with the id given in the id
+// query parameter as JSON, retrieved from the Pingdom API of the account
+// given in the account query parameter, the unnamed account by default.
+// Requests within checkInterval of the previous one are rejected.
+func checkHandler(currentAccounts func() []account) http.HandlerFunc {
+	var mutex sync.Mutex
+	var last time.Time
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Missing or invalid check id", http.StatusBadRequest)
+			return
+		}
+
+		name := r.URL.Query().Get("account")
+		acc := findAccount(currentAccounts(), name)
+		if acc == nil {
+			http.Error(w, fmt.Sprintf("Unknown account %q", name), http.StatusNotFound)
+			return
+		}
+
+		mutex.Lock()
+		wait := checkInterval - time.Since(last)
+		if wait > 0 {
+			mutex.Unlock()
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		last = time.Now()
+		mutex.Unlock()
+
+		check, err := getCheckJSON(r.Context(), acc.client, id)
+		if err != nil {
+			var apiErr *apiError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				http.Error(w, fmt.Sprintf("Check %d not found", id), http.StatusNotFound)
+				return
+			}
+
+			apiLogger(*acc, err).With("check", id).Errorln("Error getting check")
+			http.Error(w, "Error getting the check from the Pingdom API", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(check)
+	}
+}
+
+// findAccount returns the account of accounts with the given name, or nil
+// if there is none.
+func findAccount(accounts []account, name string) *account {
+	for i := range accounts {
+		if accounts[i].name == name {
+			return &accounts[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,503 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// metrics lists the metrics exposed by the collector.
+var metrics = []prometheus.Collector{
+	pingdomBuildInfo,
+	pingdomChecksTotal,
+	pingdomChecksDown,
+	pingdomChecksPaused,
+	pingdomChecksByType,
+	pingdomTagsTotal,
+	pingdomTransactionsTotal,
+	pingdomCheckStatus,
+	pingdomCheckUnknownStatus,
+	pingdomCheckStatusByRegion,
+	pingdomCheckResponseTime,
+	pingdomCheckInfo,
+	pingdomCheckStatusInfo,
+	pingdomCheckPaused,
+	pingdomCheckTag,
+	pingdomCheckResolution,
+	pingdomCheckCreated,
+	pingdomCheckLastModified,
+	pingdomCheckLastTest,
+	pingdomCheckOverdue,
+	pingdomCheckSLA,
+	pingdomCheckSLATarget,
+	pingdomCheckDowntime,
+	pingdomCheckResponseTimeAvg,
+	pingdomCheckResponseTimeHistogram,
+	pingdomCheckResponseTimeBaseline,
+	pingdomCheckResponseTimeRatio,
+	pingdomCheckContacts,
+	pingdomCheckIntegrations,
+	pingdomCheckResponseTimeThreshold,
+	pingdomCheckTargetInfo,
+	pingdomCheckStatusSince,
+	pingdomCheckOwnerInfo,
+	pingdomAccountCheckLimit,
+	pingdomAccountCheckUsed,
+	pingdomProbeInfo,
+	pingdomMaintenanceWindowActive,
+	pingdomMaintenanceWindowNextStart,
+	pingdomTransactionStatus,
+	pingdomTransactionResponseTime,
+	pingdomTransactionInterval,
+	pingdomTransactionStepStatus,
+	pingdomTransactionStepError,
+}
+
+// scrapeMetaMetrics lists the metrics about the scrapes of the Pingdom API,
+// exposed by the metaCollector of the collector so that they can be labeled
+// with the --instance-id of the exporter.
+var scrapeMetaMetrics = []prometheus.Collector{
+	pingdomUp,
+	pingdomAccountUp,
+	pingdomConsecutiveFailures,
+	pingdomScrapeDuration,
+	pingdomLastScrape,
+	pingdomCircuitBreakerOpen,
+	pingdomAuthFailure,
+	pingdomAPIRequests,
+	pingdomScrapeErrors,
+	pingdomAPIThrottleWait,
+	pingdomRateLimited,
+	pingdomRateLimitShort,
+	pingdomRateLimitLong,
+}
+
+// accountVec is a metric vector labeled with the account as its first label,
+// whose series can be deleted, e.g. a prometheus.GaugeVec.
+type accountVec interface {
+	prometheus.Collector
+	Delete(prometheus.Labels) bool
+}
+
+// checkMetrics lists the metrics of the checks, whose series are deleted for
+// an account once its checks are listed, so that those of deleted checks, or
+// of label values that changed, e.g. the last error of a check, are dropped.
+// Those of an account whose checks can't be listed are kept from its last
+// scrape.
+var checkMetrics = []accountVec{
+	pingdomChecksByType,
+	pingdomCheckStatus,
+	pingdomCheckStatusByRegion,
+	pingdomCheckResponseTime,
+	pingdomCheckInfo,
+	pingdomCheckStatusInfo,
+	pingdomCheckPaused,
+	pingdomCheckTag,
+	pingdomCheckResolution,
+	pingdomCheckCreated,
+	pingdomCheckLastModified,
+	pingdomCheckLastTest,
+	pingdomCheckOverdue,
+	pingdomCheckSLA,
+	pingdomCheckSLATarget,
+	pingdomCheckDowntime,
+	pingdomCheckResponseTimeAvg,
+	pingdomCheckResponseTimeBaseline,
+	pingdomCheckResponseTimeRatio,
+	pingdomCheckContacts,
+	pingdomCheckIntegrations,
+	pingdomCheckResponseTimeThreshold,
+	pingdomCheckTargetInfo,
+	pingdomCheckStatusSince,
+	pingdomCheckOwnerInfo,
+	pingdomMaintenanceWindowActive,
+	pingdomMaintenanceWindowNextStart,
+}
+
+// transactionMetrics lists the metrics of the transactions, likewise deleted
+// for an account once its transactions are listed.
+var transactionMetrics = []accountVec{
+	pingdomTransactionStatus,
+	pingdomTransactionResponseTime,
+	pingdomTransactionInterval,
+	pingdomTransactionStepStatus,
+	pingdomTransactionStepError,
+}
+
+// collector is a prometheus.Collector of the Pingdom metrics, retrieved
+// when its gatherer is gathered. The Pingdom API is called at most once per
+// minInterval, randomized by up to ±jitter, the metrics from the previous
+// call being served in between.
+type collector struct {
+	minInterval time.Duration
+	jitter      time.Duration
+
+	// accounts is written with both mutex and accountsMutex held, so that
+	// the scrapes can read it with mutex held and the other readers with
+	// accountsMutex.
+	accounts      []account
+	accountsMutex sync.RWMutex
+
+	mutex        sync.Mutex
+	rand         *rand.Rand
+	interval     time.Duration
+	lastScrape   time.Time
+	authFailures int
+	breakers     []breaker
+
+	// refreshMutex is held while refreshing the checkDetails, and taken by
+	// reload before mutex.
+	refreshMutex sync.Mutex
+}
+
+func newCollector(accounts []account, minInterval, jitter time.Duration) *collector {
+	return &collector{
+		accounts:    accounts,
+		minInterval: minInterval,
+		jitter:      jitter,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		breakers:    make([]breaker, len(accounts)),
+	}
+}
+
+// currentAccounts returns the accounts scraped by the collector.
+func (c *collector) currentAccounts() []account {
+	c.accountsMutex.RLock()
+	defer c.accountsMutex.RUnlock()
+
+	return c.accounts
+}
+
+// reload replaces the accounts of the collector with those returned by
+// build, once the scrape and the refresh of the checkDetails in progress are
+// done, the next collection scraping them right away. The series of the
+// removed accounts are deleted. The accounts are kept if build fails.
+func (c *collector) reload(build func() ([]account, error)) error {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	accounts, err := build()
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(accounts))
+	for _, acc := range accounts {
+		names[acc.name] = true
+	}
+	for _, acc := range c.accounts {
+		if !names[acc.name] {
+			deleteAccount(acc.name)
+		}
+	}
+
+	c.accountsMutex.Lock()
+	c.accounts = accounts
+	c.accountsMutex.Unlock()
+	accountDetails.prune(accounts)
+
+	c.breakers = make([]breaker, len(accounts))
+	c.lastScrape = time.Time{}
+
+	return nil
+}
+
+// nextInterval returns minInterval randomized by up to ±jitter, avoiding
+// exporter replicas started together calling the Pingdom API together.
+func (c *collector) nextInterval() time.Duration {
+	if c.jitter <= 0 {
+		return c.minInterval
+	}
+
+	interval := c.minInterval - c.jitter + time.Duration(c.rand.Int63n(int64(2*c.jitter)+1))
+	if interval < 0 {
+		return 0
+	}
+	return interval
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range metrics {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector. The collector must be gathered
+// through its gatherer, which scrapes the Pingdom API beforehand.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range metrics {
+		m.Collect(ch)
+	}
+}
+
+// scrapeIfDue scrapes the Pingdom API if the metrics are older than the
+// interval. It must be called with mutex held.
+func (c *collector) scrapeIfDue() {
+	if time.Since(c.lastScrape) >= c.interval {
+		c.scrape()
+		c.lastScrape = time.Now()
+		c.interval = c.nextInterval()
+	}
+}
+
+// gatherer returns the prometheus.Gatherer of g, in which the collector and
+// its metaCollector are registered. Each Gather scrapes the Pingdom API at
+// most once, if the metrics are older than the interval, and holds mutex
+// until the metrics are gathered so that those of both collectors are those
+// of the same scrape.
+func (c *collector) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		c.scrapeIfDue()
+		return g.Gather()
+	})
+}
+
+// metaCollector is a prometheus.Collector of the scrapeMetaMetrics of a
+// collector, gathered through the gatherer of the collector as well.
+type metaCollector struct {
+	c *collector
+}
+
+// Describe implements prometheus.Collector.
+func (m metaCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range scrapeMetaMetrics {
+		metric.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m metaCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range scrapeMetaMetrics {
+		metric.Collect(ch)
+	}
+}
+
+func (c *collector) scrape() {
+	ctx := context.Background()
+
+	// The accounts are scraped concurrently, up to maxConcurrency at a
+	// time. The accounts whose circuit breaker is open are skipped, keeping
+	// the result of their last scrape.
+	now := time.Now()
+	results := make([]scrapeResult, len(c.accounts))
+	scraped := make([]bool, len(c.accounts))
+	sem := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	for i, acc := range c.accounts {
+		if c.breakers[i].isOpen(now) {
+			results[i] = c.breakers[i].last
+			continue
+		}
+		scraped[i] = true
+
+		wg.Add(1)
+		go func(i int, acc account) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = scrapeAccount(ctx, acc)
+		}(i, acc)
+	}
+	wg.Wait()
+
+	ok := true
+	authFailed := false
+	for i, result := range results {
+		ok = ok && result.ok
+		authFailed = authFailed || result.authFailed
+
+		if scraped[i] {
+			name := c.accounts[i].name
+			if c.breakers[i].record(result, time.Now()) {
+				log.With("account", name).Warnf("Scrape failed %d times in a row, not calling the Pingdom API for %ds", c.breakers[i].failures, circuitBreakerSeconds)
+				pingdomCircuitBreakerOpen.WithLabelValues(name).Set(1)
+			} else {
+				pingdomCircuitBreakerOpen.WithLabelValues(name).Set(0)
+			}
+		}
+
+		if result.ok {
+			pingdomAccountUp.WithLabelValues(c.accounts[i].name).Set(1)
+			pingdomLastScrape.WithLabelValues(c.accounts[i].name).SetToCurrentTime()
+		} else {
+			pingdomAccountUp.WithLabelValues(c.accounts[i].name).Set(0)
+		}
+	}
+	recordScrape(ok)
+
+	// Wrong credentials won't fix themselves, exit to get the exporter
+	// restarted or alerted on by its supervisor.
+	if authFailed {
+		c.authFailures++
+	} else {
+		c.authFailures = 0
+	}
+	if maxAuthFailures > 0 && c.authFailures >= maxAuthFailures {
+		log.Fatalf("Authentication to the Pingdom API failed %d times in a row, exiting", c.authFailures)
+	}
+}
+
+// scrapeResult is the outcome of the scrape of an account.
+type scrapeResult struct {
+	ok         bool
+	authFailed bool
+}
+
+// scrapeAccount retrieves the metrics of acc, the checks, the transactions,
+// the account usage and the probes being retrieved concurrently unless
+// disabled. The metrics of the checkDetails are set from their last refresh.
+func scrapeAccount(ctx context.Context, acc account) scrapeResult {
+	var checksErr, transactionsErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		if disableChecks {
+			return
+		}
+
+		start := time.Now()
+		var checks []checkResponse
+		checks, checksErr = retrieveChecksMetrics(ctx, acc)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "checks").Set(time.Since(start).Seconds())
+		if checksErr != nil {
+			return
+		}
+
+		if detailsEnabled() {
+			setDetailsMetrics(acc, checks, accountDetails.get(acc.name))
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		if disableTransactions {
+			return
+		}
+
+		start := time.Now()
+		var transactions map[int]transactionResponse
+		transactions, transactionsErr = retrieveTransactionMetrics(ctx, acc)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "transactions").Set(time.Since(start).Seconds())
+		if transactionsErr != nil {
+			return
+		}
+
+		if enableTransactionSteps {
+			start = time.Now()
+			retrieveTransactionStepsMetrics(ctx, acc, transactions)
+			pingdomScrapeDuration.WithLabelValues(acc.name, "transaction_steps").Set(time.Since(start).Seconds())
+		}
+	}()
+
+	if enableAccountMetrics || enableProbes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if enableAccountMetrics {
+				start := time.Now()
+				retrieveAccountMetrics(ctx, acc)
+				pingdomScrapeDuration.WithLabelValues(acc.name, "account").Set(time.Since(start).Seconds())
+			}
+
+			if enableProbes {
+				start := time.Now()
+				retrieveProbeMetrics(ctx, acc)
+				pingdomScrapeDuration.WithLabelValues(acc.name, "probes").Set(time.Since(start).Seconds())
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	authFailed := isAuthError(checksErr) || isAuthError(transactionsErr)
+	if authFailed {
+		pingdomAuthFailure.WithLabelValues(acc.name).Set(1)
+	} else {
+		pingdomAuthFailure.WithLabelValues(acc.name).Set(0)
+	}
+
+	return scrapeResult{
+		ok:         checksErr == nil && transactionsErr == nil,
+		authFailed: authFailed,
+	}
+}
+
+// deleteAccountSeries deletes the series of vecs labeled with the account
+// with the given name, keeping those of the other accounts.
+func deleteAccountSeries(vecs []accountVec, name string) {
+	for _, vec := range vecs {
+		// The series are collected before being deleted, as Delete waits
+		// for the collection to complete.
+		ch := make(chan prometheus.Metric)
+		go func() {
+			vec.Collect(ch)
+			close(ch)
+		}()
+
+		var series []prometheus.Labels
+		for m := range ch {
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				continue
+			}
+
+			labels := make(prometheus.Labels, len(pb.Label))
+			for _, pair := range pb.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if labels["account"] == name {
+				series = append(series, labels)
+			}
+		}
+
+		for _, labels := range series {
+			vec.Delete(labels)
+		}
+	}
+}
+
+// deleteAccount deletes all the series of the account with the given name,
+// e.g. removed by a reload, and the state kept for its checks.
+func deleteAccount(name string) {
+	var vecs []accountVec
+	for _, ms := range [][]prometheus.Collector{metrics, scrapeMetaMetrics} {
+		for _, m := range ms {
+			if vec, ok := m.(accountVec); ok {
+				vecs = append(vecs, vec)
+			}
+		}
+	}
+	deleteAccountSeries(vecs, name)
+
+	responseTimeBaselines.prune(name, nil)
+	lastCheckErrors.prune(name, nil)
+	observedResponseTimes.prune(name, nil)
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeAuthFailure(t *testing.T) {
+	defer func(retries int) { maxRetries = retries }(maxRetries)
+	defer func(state int32) { atomic.StoreInt32(&scrapeState, state) }(atomic.LoadInt32(&scrapeState))
+	maxRetries = 3
+
+	var mutex sync.Mutex
+	calls := map[string]int{}
+	authorized := false
+	acc, cleanup := newTestAccountHandler(t, "auth", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls[r.URL.Path]++
+
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"statuscode": 401, "statusdesc": "Unauthorized", "errormessage": "Invalid credentials"}}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/checks":
+			fmt.Fprint(w, `{"checks": []}`)
+		default:
+			fmt.Fprint(w, `{"recipes": {}}`)
+		}
+	}))
+	defer cleanup()
+	c := newCollector([]account{acc}, time.Second, 0)
+
+	c.scrape()
+	if c.authFailures != 1 {
+		t.Errorf("got %d auth failures, want 1", c.authFailures)
+	}
+	want := map[string]float64{"": 1}
+	if got := series(pingdomAuthFailure, acc.name); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got pingdom_auth_failure %v, want %v", got, want)
+	}
+	// The authentication failures aren't retried.
+	mutex.Lock()
+	if calls["/checks"] != 1 || calls["/tms.recipes"] != 1 {
+		t.Errorf("got calls %v, want a single call per endpoint", calls)
+	}
+	authorized = true
+	mutex.Unlock()
+	c.scrape()
+	if c.authFailures != 0 {
+		t.Errorf("got %d auth failures after a successful scrape, want 0", c.authFailures)
+	}
+	want = map[string]float64{"": 0}
+	if got := series(pingdomAuthFailure, acc.name); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got pingdom_auth_failure %v after a successful scrape, want %v", got, want)
+	}
+}
+
+func TestScrapeFailingAccount(t *testing.T) {
+	defer func(retries int) { maxRetries = retries }(maxRetries)
+	defer func(state int32) { atomic.StoreInt32(&scrapeState, state) }(atomic.LoadInt32(&scrapeState))
+	maxRetries = 0
+
+	good, cleanupGood := newTestAccount(t, "good", map[string]string{
+		"/checks":      `{"checks": [{"id": 1, "name": "web", "hostname": "example.com", "status": "up"}]}`,
+		"/tms.recipes": `{"recipes": {}}`,
+	})
+	defer cleanupGood()
+	bad, cleanupBad := newTestAccountHandler(t, "bad", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"error": {"statuscode": 500, "statusdesc": "Internal Server Error", "errormessage": "Internal error"}}`)
+	}))
+	defer cleanupBad()
+
+	c := newCollector([]account{bad, good}, time.Second, 0)
+	c.scrape()
+
+	tests := []struct {
+		account string
+		up      float64
+		checks  map[string]float64
+	}{
+		{good.name, 1, map[string]float64{"hostname=example.com,name=web,status=up": 1}},
+		{bad.name, 0, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		want := map[string]float64{"": tt.up}
+		if got := series(pingdomAccountUp, tt.account); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got pingdom_account_up %v for %s, want %v", got, tt.account, want)
+		}
+		if got := series(pingdomCheckStatusInfo, tt.account); fmt.Sprint(got) != fmt.Sprint(tt.checks) {
+			t.Errorf("got series %v for %s, want %v", got, tt.account, tt.checks)
+		}
+	}
+}
+
+func TestMetaCollectorInstanceID(t *testing.T) {
+	defer func(id string) { instanceID = id }(instanceID)
+	defer func(state int32) { atomic.StoreInt32(&scrapeState, state) }(atomic.LoadInt32(&scrapeState))
+
+	acc, cleanup := newTestAccount(t, "instance", map[string]string{
+		"/checks":      `{"checks": [{"id": 1, "name": "web", "hostname": "example.com", "status": "up"}]}`,
+		"/tms.recipes": `{"recipes": {}}`,
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		instanceID string
+	}{
+		{"set", "pingdom-exporter-0"},
+		{"unset", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instanceID = tt.instanceID
+			registry := prometheus.NewRegistry()
+			c := newCollector([]account{acc}, time.Second, 0)
+			registry.MustRegister(c)
+			instanceRegisterer(registry).MustRegister(metaCollector{c: c})
+
+			mfs, err := c.gatherer(registry).Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The names of the meta families, gathered without the label.
+			metaRegistry := prometheus.NewRegistry()
+			metaRegistry.MustRegister(metaCollector{c: c})
+			metaFamilies, err := metaRegistry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := map[string]bool{}
+			for _, mf := range metaFamilies {
+				meta[mf.GetName()] = true
+			}
+
+			var found int
+			for _, mf := range mfs {
+				if meta[mf.GetName()] {
+					found++
+				}
+				for _, m := range mf.Metric {
+					var got string
+					for _, pair := range m.Label {
+						if pair.GetName() == "instance_id" {
+							got = pair.GetValue()
+						}
+					}
+					want := ""
+					if meta[mf.GetName()] {
+						want = tt.instanceID
+					}
+					if got != want {
+						t.Errorf("got instance_id %q on %s, want %q", got, mf.GetName(), want)
+					}
+				}
+			}
+			if found == 0 {
+				t.Error("got no scrape metrics")
+			}
+		})
+	}
+}
+
+func TestCollectorGathererMinInterval(t *testing.T) {
+	defer func(state int32) { atomic.StoreInt32(&scrapeState, state) }(atomic.LoadInt32(&scrapeState))
+
+	var calls int32
+	acc, cleanup := newTestAccountHandler(t, "interval", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/checks" {
+			atomic.AddInt32(&calls, 1)
+			fmt.Fprint(w, `{"checks": [{"id": 1, "name": "web", "hostname": "example.com", "status": "up"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"recipes": {}}`)
+	}))
+	defer cleanup()
+
+	registry := prometheus.NewRegistry()
+	c := newCollector([]account{acc}, 200*time.Millisecond, 0)
+	registry.MustRegister(c)
+	gatherer := c.gatherer(registry)
+
+	// The concurrent scrapes within the interval share the result of the
+	// first one.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := gatherer.Gather(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got %d calls for concurrent scrapes, want 1", n)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if _, err := gatherer.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("got %d calls after the interval, want 2", n)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// redacted replaces the value of the secrets in the /config endpoint.
+const redacted = "<secret>"
+
+// secretFlags lists the flags whose value is redacted from the /config
+// endpoint.
+var secretFlags = map[string]bool{
+	"account":           true,
+	"api-token":         true,
+	"web.auth-password": true,
+}
+
+// urlFlags lists the flags holding a URL whose user information is removed
+// from the /config endpoint, as it may hold a password.
+var urlFlags = map[string]bool{
+	"push-gateway-url": true,
+}
+
+// credentialKeys lists the keys of the credentials given as positional
+// arguments, which can be set in the environment and the configuration file.
+var credentialKeys = []string{"username", "password", "api-key", "account-email"}
+
+// noEnvFlags lists the flags that can't be set in the environment, as their
+// variable collides with the ones set by Kubernetes. --web.listen-address
+// can be set instead of --port.
+var noEnvFlags = map[string]bool{
+	"config": true,
+	"port":   true,
+}
+
+var configFile string
+
+// loadConfig returns the configuration of cmd, read from the PINGDOM_*
+// environment variables and the --config file, in this order of precedence.
+// The flags of cmd that are not given on the command line are set from it,
+// only those in only unless nil. Those of only that it doesn't set are reset
+// to their default value, so that the keys removed from the configuration
+// file or the environment are dropped on reload.
+func loadConfig(cmd *cobra.Command, only map[string]bool) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetEnvPrefix("pingdom")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	// Only the credentials and the flags are bound rather than any PINGDOM_*
+	// variable, so that the variables set by Kubernetes for a Service
+	// named pingdom (PINGDOM_PORT, PINGDOM_SERVICE_HOST...) are ignored.
+	for _, key := range credentialKeys {
+		_ = v.BindEnv(key)
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !noEnvFlags[f.Name] {
+			_ = v.BindEnv(f.Name)
+		}
+	})
+
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %v", configFile, err)
+		}
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" {
+			return
+		}
+		if only != nil && !only[f.Name] {
+			return
+		}
+		if !v.IsSet(f.Name) {
+			if only != nil {
+				if resetErr := resetFlag(f); resetErr != nil {
+					err = fmt.Errorf("invalid default value for %s: %v", f.Name, resetErr)
+				}
+			}
+			return
+		}
+		// The slices are replaced rather than appended to, so that they
+		// aren't duplicated when the configuration is reloaded. They are
+		// given as a list in the configuration file, or as a single value
+		// in the environment.
+		var setErr error
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			values := v.GetStringSlice(f.Name)
+			if s, ok := v.Get(f.Name).(string); ok {
+				values = []string{s}
+			}
+			setErr = slice.Replace(values)
+		} else {
+			setErr = f.Value.Set(v.GetString(f.Name))
+		}
+		if setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %v", f.Name, setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// resetFlag sets f back to its default value, given as [a,b] for the
+// slices.
+func resetFlag(f *pflag.Flag) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		var values []string
+		if def := strings.TrimSuffix(strings.TrimPrefix(f.DefValue, "["), "]"); def != "" {
+			values = strings.Split(def, ",")
+		}
+		return slice.Replace(values)
+	}
+
+	return f.Value.Set(f.DefValue)
+}
+
+// configHandler reports the effective value of flags along with the values
+// returned by credentials as JSON, with the secrets redacted.
+func configHandler(flags *pflag.FlagSet, credentials func() map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := map[string]string{}
+		for k, v := range credentials() {
+			config[k] = v
+		}
+		flags.VisitAll(func(f *pflag.Flag) {
+			if f.Name == "help" {
+				return
+			}
+
+			value := f.Value.String()
+			if secretFlags[f.Name] && value != "" {
+				value = redacted
+			}
+			if urlFlags[f.Name] {
+				value = stripUserinfo(value)
+			}
+			config[f.Name] = value
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(config)
+	}
+}
+
+// stripUserinfo returns rawurl without its user information, or redacted if
+// it can't be parsed.
+func stripUserinfo(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return redacted
+	}
+	u.User = nil
+	return u.String()
+}
+
+// saveFlags returns the values of the flags of flags in names, to be
+// restored with restoreFlags.
+func saveFlags(flags *pflag.FlagSet, names map[string]bool) map[string][]string {
+	saved := map[string][]string{}
+	flags.VisitAll(func(f *pflag.Flag) {
+		if !names[f.Name] {
+			return
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			saved[f.Name] = slice.GetSlice()
+		} else {
+			saved[f.Name] = []string{f.Value.String()}
+		}
+	})
+
+	return saved
+}
+
+// restoreFlags sets the flags of flags back to the values saved by
+// saveFlags.
+func restoreFlags(flags *pflag.FlagSet, saved map[string][]string) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		values, ok := saved[f.Name]
+		if !ok {
+			return
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(values)
+		} else {
+			_ = f.Value.Set(values[0])
+		}
+	})
+}
@@ -0,0 +1,543 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/strike-team/go-pingdom/pingdom"
+)
+
+// checkDetails holds the data of the checks of an account requiring a call
+// to the Pingdom API per check, or per user for the owners. It is refreshed
+// in the background by the collector, the scrapes setting the metrics from
+// the last refresh so that /metrics doesn't wait for these calls.
+type checkDetails struct {
+	uptime         map[int]uptimeStatus
+	lastSLARefresh time.Time
+	performance    map[int]float64
+	regions        map[int]map[string]float64
+	owners         map[int][]string
+	checks         map[int]*checkResponse
+	maintenance    []pingdom.MaintenanceResponse
+}
+
+// uptimeStatus is the time, in seconds, a check was up and down over the
+// SLA window.
+type uptimeStatus struct {
+	up   int64
+	down int64
+}
+
+// detailsCache holds the checkDetails of the accounts by name.
+type detailsCache struct {
+	mutex    sync.Mutex
+	accounts map[string]checkDetails
+}
+
+// accountDetails are the checkDetails of the scraped accounts.
+var accountDetails = &detailsCache{accounts: map[string]checkDetails{}}
+
+// get returns the checkDetails of the account with the given name, empty
+// until its first refresh.
+func (d *detailsCache) get(name string) checkDetails {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.accounts[name]
+}
+
+// set replaces the checkDetails of the account with the given name. The
+// maps of details must not be modified afterwards.
+func (d *detailsCache) set(name string, details checkDetails) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.accounts[name] = details
+}
+
+// prune drops the checkDetails of the accounts other than accounts, e.g.
+// those removed by a reload.
+func (d *detailsCache) prune(accounts []account) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	names := make(map[string]bool, len(accounts))
+	for _, acc := range accounts {
+		names[acc.name] = true
+	}
+	for name := range d.accounts {
+		if !names[name] {
+			delete(d.accounts, name)
+		}
+	}
+}
+
+// detailsEnabled returns whether the flags enable one of the checkDetails.
+func detailsEnabled() bool {
+	return enableSLA || enablePerformance || enableRegionMetrics || enableCheckOwners || enableCheckDetails || enableMaintenance
+}
+
+// refreshDetails refreshes the checkDetails of the accounts, up to
+// maxConcurrency at a time. It holds refreshMutex, so that a reload doesn't
+// change the accounts or the flags in the middle of it.
+func (c *collector) refreshDetails() {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	ctx := context.Background()
+	accounts := c.currentAccounts()
+	sem := make(chan struct{}, maxConcurrency)
+	var wg sync.WaitGroup
+	for _, acc := range accounts {
+		wg.Add(1)
+		go func(acc account) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			accountDetails.set(acc.name, refreshAccountDetails(ctx, acc, accountDetails.get(acc.name)))
+		}(acc)
+	}
+	wg.Wait()
+
+	accountDetails.prune(accounts)
+}
+
+// refreshDetailsLoop refreshes the checkDetails every interval, of at least
+// a second, starting after the first interval.
+func (c *collector) refreshDetailsLoop(interval time.Duration) {
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	for {
+		time.Sleep(interval)
+		c.refreshDetails()
+	}
+}
+
+// refreshAccountDetails returns the checkDetails of acc enabled by the
+// flags, listing its checks on its own. The details of a check that can't
+// be retrieved are kept from previous, the failures being logged without
+// affecting pingdom_up. The SLA is retrieved again slaWaitSeconds after it
+// was last retrieved for all the checks.
+func refreshAccountDetails(ctx context.Context, acc account, previous checkDetails) checkDetails {
+	checks, err := listAllChecks(ctx, acc.client, checkParams())
+	if err != nil {
+		apiLogger(acc, err).Errorln("Error getting checks, keeping their previous details")
+		return previous
+	}
+	checks = filterChecks(checks)
+	if skipPaused {
+		active := checks[:0]
+		for _, check := range checks {
+			if !check.Paused && check.Status != "paused" {
+				active = append(active, check)
+			}
+		}
+		checks = active
+	}
+
+	details := previous
+	if enableSLA && time.Since(previous.lastSLARefresh) >= time.Second*time.Duration(slaWaitSeconds) {
+		start := time.Now()
+		var ok bool
+		if details.uptime, ok = retrieveUptime(ctx, acc, checks, previous.uptime); ok {
+			details.lastSLARefresh = time.Now()
+		}
+		pingdomScrapeDuration.WithLabelValues(acc.name, "sla").Set(time.Since(start).Seconds())
+	}
+
+	if enablePerformance {
+		start := time.Now()
+		details.performance = retrievePerformance(ctx, acc, checks, previous.performance)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "performance").Set(time.Since(start).Seconds())
+	}
+
+	if enableRegionMetrics {
+		start := time.Now()
+		details.regions = retrieveRegions(ctx, acc, checks, previous.regions)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "regions").Set(time.Since(start).Seconds())
+	}
+
+	if enableCheckOwners {
+		start := time.Now()
+		details.owners = retrieveOwners(ctx, acc, checks, previous.owners)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "owners").Set(time.Since(start).Seconds())
+	}
+
+	if enableCheckDetails {
+		start := time.Now()
+		details.checks = retrieveCheckDetails(ctx, acc, checks, previous.checks)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "details").Set(time.Since(start).Seconds())
+	}
+
+	if enableMaintenance {
+		start := time.Now()
+		details.maintenance = retrieveMaintenance(ctx, acc, previous.maintenance)
+		pingdomScrapeDuration.WithLabelValues(acc.name, "maintenance").Set(time.Since(start).Seconds())
+	}
+
+	return details
+}
+
+// retrieveUptime returns the time the checks were up and down over the last
+// slaWindowDays days by id, and whether it was retrieved for all of them,
+// that of previous being kept for the others.
+func retrieveUptime(ctx context.Context, acc account, checks []checkResponse, previous map[int]uptimeStatus) (map[int]uptimeStatus, bool) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -slaWindowDays)
+	params := map[string]string{
+		"from":          strconv.FormatInt(from.Unix(), 10),
+		"to":            strconv.FormatInt(to.Unix(), 10),
+		"includeuptime": "true",
+	}
+
+	uptime := make(map[int]uptimeStatus, len(checks))
+	ok := true
+	for _, check := range checks {
+		summary, err := getSummaryAverage(ctx, acc.client, check.ID, params)
+		if err != nil {
+			apiLogger(acc, err).With("check", check.Name).Errorln("Error getting uptime")
+			if status, found := previous[check.ID]; found {
+				uptime[check.ID] = status
+			}
+			ok = false
+			continue
+		}
+
+		status := summary.Status
+		if status.TotalUp+status.TotalDown == 0 {
+			continue
+		}
+		uptime[check.ID] = uptimeStatus{up: status.TotalUp, down: status.TotalDown}
+	}
+
+	return uptime, ok
+}
+
+// retrievePerformance returns the average response time of the checks over
+// the last performanceWindowHours hours by id, weighting the hourly averages
+// by the time the check was up. That of previous is kept for the checks for
+// which it can't be retrieved.
+func retrievePerformance(ctx context.Context, acc account, checks []checkResponse, previous map[int]float64) map[int]float64 {
+	to := time.Now()
+	from := to.Add(-time.Hour * time.Duration(performanceWindowHours))
+	params := map[string]string{
+		"from":          strconv.FormatInt(from.Unix(), 10),
+		"to":            strconv.FormatInt(to.Unix(), 10),
+		"resolution":    "hour",
+		"includeuptime": "true",
+	}
+
+	performance := make(map[int]float64, len(checks))
+	for _, check := range checks {
+		summary, err := getSummaryPerformance(ctx, acc.client, check.ID, params)
+		if err != nil {
+			apiLogger(acc, err).With("check", check.Name).Errorln("Error getting performance")
+			if avg, found := previous[check.ID]; found {
+				performance[check.ID] = avg
+			}
+			continue
+		}
+
+		var total, uptime float64
+		for _, hour := range summary.Hours {
+			total += float64(hour.AvgResponse) * float64(hour.Uptime)
+			uptime += float64(hour.Uptime)
+		}
+		if uptime == 0 {
+			continue
+		}
+		performance[check.ID] = total / uptime
+	}
+
+	return performance
+}
+
+// retrieveRegions returns the status of the checks from each probe region
+// by id, that of the last test from the region within the last hour. That of
+// previous is kept for the checks for which it can't be retrieved.
+func retrieveRegions(ctx context.Context, acc account, checks []checkResponse, previous map[int]map[string]float64) map[int]map[string]float64 {
+	probes := listProbeRegions(ctx, acc)
+	if probes == nil {
+		return previous
+	}
+
+	params := map[string]string{
+		"from": strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10),
+	}
+
+	regions := make(map[int]map[string]float64, len(checks))
+	for _, check := range checks {
+		results, err := getResults(ctx, acc.client, check.ID, params)
+		if err != nil {
+			apiLogger(acc, err).With("check", check.Name).Errorln("Error getting results")
+			if statuses, found := previous[check.ID]; found {
+				regions[check.ID] = statuses
+			}
+			continue
+		}
+
+		// The results are sorted from the most recent.
+		statuses := map[string]float64{}
+		for _, result := range results.Results {
+			region := probeRegion(probes, result.ProbeID)
+			if _, seen := statuses[region]; seen {
+				continue
+			}
+			statuses[region], _ = statusValue(result.Status)
+		}
+		regions[check.ID] = statuses
+	}
+
+	return regions
+}
+
+// retrieveOwners returns the owners of the checks by id, the users for which
+// the checks list filtered by user id returns them. The checks owned by a
+// user whose checks can't be retrieved keep them from previous.
+func retrieveOwners(ctx context.Context, acc account, checks []checkResponse, previous map[int][]string) map[int][]string {
+	var users []pingdom.UsersResponse
+	err := withRetries(ctx, func() (err error) {
+		users, err = listUsers(ctx, acc.client)
+		return err
+	})
+	if err != nil {
+		apiLogger(acc, err).Errorln("Error getting users")
+		return previous
+	}
+
+	ids := make(map[int]bool, len(checks))
+	for _, check := range checks {
+		ids[check.ID] = true
+	}
+
+	owners := make(map[int][]string, len(checks))
+	for _, user := range users {
+		owner := user.Username
+		if owner == "" {
+			owner = strconv.Itoa(user.Id)
+		}
+
+		params := apiParams()
+		params["userids"] = strconv.Itoa(user.Id)
+		owned, err := listAllChecks(ctx, acc.client, params)
+		if err != nil {
+			apiLogger(acc, err).With("user", user.Id).Errorln("Error getting the checks of user")
+			for id, names := range previous {
+				for _, name := range names {
+					if name == owner && ids[id] {
+						owners[id] = append(owners[id], owner)
+					}
+				}
+			}
+			continue
+		}
+
+		for _, check := range owned {
+			if ids[check.ID] {
+				owners[check.ID] = append(owners[check.ID], owner)
+			}
+		}
+	}
+
+	return owners
+}
+
+// retrieveCheckDetails returns the detailed checks by id, holding the
+// alerting configuration that the checks list doesn't return. That of
+// previous is kept for the checks whose details can't be retrieved.
+func retrieveCheckDetails(ctx context.Context, acc account, checks []checkResponse, previous map[int]*checkResponse) map[int]*checkResponse {
+	details := make(map[int]*checkResponse, len(checks))
+	for _, check := range checks {
+		d, err := getCheck(ctx, acc.client, check.ID)
+		if err != nil {
+			apiLogger(acc, err).With("check", check.Name).Errorln("Error getting check details")
+			if d, found := previous[check.ID]; found {
+				details[check.ID] = d
+			}
+			continue
+		}
+		details[check.ID] = d
+	}
+
+	return details
+}
+
+// retrieveMaintenance returns the maintenance windows of acc, or previous
+// if they can't be retrieved.
+func retrieveMaintenance(ctx context.Context, acc account, previous []pingdom.MaintenanceResponse) []pingdom.MaintenanceResponse {
+	var windows []pingdom.MaintenanceResponse
+	err := withRetries(ctx, func() (err error) {
+		windows, err = listMaintenance(ctx, acc.client)
+		return err
+	})
+	if err != nil {
+		apiLogger(acc, err).Errorln("Error getting maintenance windows")
+		return previous
+	}
+
+	return windows
+}
+
+// setDetailsMetrics sets the metrics of checks from details, those of the
+// checks that aren't in details, e.g. created since the last refresh, being
+// left unset.
+func setDetailsMetrics(acc account, checks []checkResponse, details checkDetails) {
+	names := make(map[int]string, len(checks))
+	for _, check := range checks {
+		names[check.ID] = check.Name
+
+		if status, ok := details.uptime[check.ID]; ok {
+			pingdomCheckSLA.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(100 * float64(status.up) / float64(status.up+status.down))
+
+			pingdomCheckDowntime.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(float64(status.down))
+		}
+
+		if avg, ok := details.performance[check.ID]; ok {
+			pingdomCheckResponseTimeAvg.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(avg)
+		}
+
+		for region, status := range details.regions[check.ID] {
+			pingdomCheckStatusByRegion.WithLabelValues(
+				acc.name,
+				check.Name,
+				region,
+			).Set(status)
+		}
+
+		for _, owner := range details.owners[check.ID] {
+			pingdomCheckOwnerInfo.WithLabelValues(acc.name, check.Name, owner).Set(1)
+		}
+
+		if d, ok := details.checks[check.ID]; ok {
+			setCheckDetailsMetrics(acc, check, d)
+		}
+	}
+
+	setMaintenanceMetrics(acc, names, details.maintenance, time.Now())
+}
+
+// windowSeries identifies a series of pingdom_maintenance_window_active.
+type windowSeries struct {
+	name   string
+	checks string
+}
+
+// nextWindow is the earliest upcoming maintenance window of a check.
+type nextWindow struct {
+	name  string
+	start time.Time
+}
+
+// setMaintenanceMetrics sets the metrics of the maintenance windows at now,
+// names holding the names of the checks by id. The windows with the same
+// description and checks share their series, active if one of them is, and
+// the next start is that of the earliest upcoming window of each check.
+func setMaintenanceMetrics(acc account, names map[int]string, windows []pingdom.MaintenanceResponse, now time.Time) {
+	active := map[windowSeries]float64{}
+	next := map[int]nextWindow{}
+	for _, window := range windows {
+		var checkNames []string
+		for _, id := range window.Checks.Uptime {
+			if name, ok := names[id]; ok {
+				checkNames = append(checkNames, name)
+			}
+		}
+		sort.Strings(checkNames)
+
+		series := windowSeries{window.Description, strings.Join(checkNames, ",")}
+		if maintenanceActive(window, now) {
+			active[series] = 1
+		} else if _, ok := active[series]; !ok {
+			active[series] = 0
+		}
+
+		start, ok := maintenanceNextStart(window, now)
+		if !ok {
+			continue
+		}
+		for _, id := range window.Checks.Uptime {
+			if _, ok := names[id]; !ok {
+				continue
+			}
+			if w, ok := next[id]; !ok || start.Before(w.start) || start.Equal(w.start) && window.Description < w.name {
+				next[id] = nextWindow{window.Description, start}
+			}
+		}
+	}
+
+	for series, value := range active {
+		pingdomMaintenanceWindowActive.WithLabelValues(acc.name, series.name, series.checks).Set(value)
+	}
+	for id, w := range next {
+		pingdomMaintenanceWindowNextStart.WithLabelValues(acc.name, w.name, names[id]).Set(float64(w.start.Unix()))
+	}
+}
+
+// setCheckDetailsMetrics sets the alerting metrics of check from its
+// details.
+func setCheckDetailsMetrics(acc account, check checkResponse, details *checkResponse) {
+	pingdomCheckContacts.WithLabelValues(
+		acc.name,
+		check.Name,
+	).Set(float64(len(details.UserIds)))
+
+	pingdomCheckIntegrations.WithLabelValues(
+		acc.name,
+		check.Name,
+	).Set(float64(len(details.IntegrationIds)))
+
+	if details.ResponseTimeThreshold > 0 {
+		pingdomCheckResponseTimeThreshold.WithLabelValues(
+			acc.name,
+			check.Name,
+			check.Hostname,
+		).Set(float64(details.ResponseTimeThreshold))
+	}
+
+	// The hostname of the details isn't normalized, so that it can be
+	// exported as raw_hostname with --normalize-hostname.
+	var rawHostname string
+	if normalizeHostnames {
+		rawHostname = details.Hostname
+	}
+
+	pingdomCheckTargetInfo.WithLabelValues(
+		acc.name,
+		check.Name,
+		check.Hostname,
+		targetIP(check.Hostname),
+		rawHostname,
+	).Set(1)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/strike-team/go-pingdom/pingdom"
+)
+
+func TestSetCheckDetailsMetricsTargetInfo(t *testing.T) {
+	defer func(normalize bool) { normalizeHostnames = normalize }(normalizeHostnames)
+
+	tests := []struct {
+		name      string
+		normalize bool
+		hostname  string
+		raw       string
+		want      map[string]float64
+	}{
+		{"not normalized", false, "https://example.com:443/path", "https://example.com:443/path", map[string]float64{
+			"hostname=https://example.com:443/path,ip=,name=web,raw_hostname=": 1,
+		}},
+		{"normalized", true, "example.com", "https://example.com:443/path", map[string]float64{
+			"hostname=example.com,ip=,name=web,raw_hostname=https://example.com:443/path": 1,
+		}},
+		{"normalized ip", true, "192.0.2.1", "http://192.0.2.1:8080", map[string]float64{
+			"hostname=192.0.2.1,ip=192.0.2.1,name=web,raw_hostname=http://192.0.2.1:8080": 1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizeHostnames = tt.normalize
+			acc := account{name: "target"}
+			defer deleteAccountSeries(checkMetrics, acc.name)
+
+			check := checkResponse{CheckResponse: pingdom.CheckResponse{ID: 1, Name: "web", Hostname: tt.hostname}}
+			details := &checkResponse{CheckResponse: pingdom.CheckResponse{ID: 1, Name: "web", Hostname: tt.raw}}
+			setCheckDetailsMetrics(acc, check, details)
+
+			if got := series(pingdomCheckTargetInfo, acc.name); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got series %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMaintenanceMetrics(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := func(description string, from time.Duration, ids ...int) pingdom.MaintenanceResponse {
+		return pingdom.MaintenanceResponse{
+			Description:    description,
+			From:           now.Add(from).Unix(),
+			To:             now.Add(from + time.Hour).Unix(),
+			RecurrenceType: "none",
+			Checks:         pingdom.MaintenanceCheckResponse{Uptime: ids},
+		}
+	}
+
+	acc := account{name: "maintenance"}
+	defer deleteAccountSeries(checkMetrics, acc.name)
+	names := map[int]string{1: "web", 2: "api"}
+	setMaintenanceMetrics(acc, names, []pingdom.MaintenanceResponse{
+		window("deploy", 2*time.Hour, 1),
+		window("deploy", time.Hour, 1),
+		window("deploy", -30*time.Minute, 1),
+		window("deploy", 3*time.Hour, 2),
+		window("backup", 4*time.Hour, 1, 2, 3),
+	}, now)
+
+	tests := []struct {
+		metric prometheus.Collector
+		want   map[string]float64
+	}{
+		{pingdomMaintenanceWindowActive, map[string]float64{
+			"checks=web,name=deploy":     1,
+			"checks=api,name=deploy":     0,
+			"checks=api,web,name=backup": 0,
+		}},
+		{pingdomMaintenanceWindowNextStart, map[string]float64{
+			"check=web,name=deploy": float64(now.Add(time.Hour).Unix()),
+			"check=api,name=deploy": float64(now.Add(3 * time.Hour).Unix()),
+		}},
+	}
+	for _, tt := range tests {
+		if got := series(tt.metric, acc.name); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("got series %v, want %v", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// The states of the last scrape of the Pingdom API.
+const (
+	scrapePending int32 = iota
+	scrapeSucceeded
+	scrapeFailed
+)
+
+// scrapeState holds the state of the last scrape of the Pingdom API, and is
+// accessed atomically.
+var scrapeState = scrapePending
+
+// recordScrape records whether the last scrape of the Pingdom API succeeded
+// for all the accounts.
+func recordScrape(ok bool) {
+	if ok {
+		atomic.StoreInt32(&scrapeState, scrapeSucceeded)
+	} else {
+		atomic.StoreInt32(&scrapeState, scrapeFailed)
+	}
+}
+
+// healthHandler reports whether the last scrape of the Pingdom API
+// succeeded, failing until the first scrape completes.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	switch atomic.LoadInt32(&scrapeState) {
+	case scrapeSucceeded:
+		fmt.Fprintln(w, "OK")
+	case scrapePending:
+		http.Error(w, "Waiting for the first scrape of the Pingdom API", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "The last scrape of the Pingdom API failed", http.StatusServiceUnavailable)
+	}
+}
+
+// liveHandler reports that the exporter is running, whatever the state of
+// the Pingdom API, so that a liveness probe doesn't restart it while Pingdom
+// is down.
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "OK")
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	defer func(retries, threshold int) { maxRetries, circuitBreakerThreshold = retries, threshold }(maxRetries, circuitBreakerThreshold)
+	defer func(state int32) { atomic.StoreInt32(&scrapeState, state) }(atomic.LoadInt32(&scrapeState))
+	maxRetries = 0
+	circuitBreakerThreshold = 1
+	atomic.StoreInt32(&scrapeState, scrapePending)
+
+	var failing int32
+	var calls int32
+	acc, cleanup := newTestAccountHandler(t, "health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error": {"statuscode": 500, "statusdesc": "Internal Server Error", "errormessage": "Internal error"}}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/checks":
+			fmt.Fprint(w, `{"checks": []}`)
+		default:
+			fmt.Fprint(w, `{"recipes": {}}`)
+		}
+	}))
+	defer cleanup()
+	c := newCollector([]account{acc}, time.Second, 0)
+
+	health := func() int {
+		rec := httptest.NewRecorder()
+		healthHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	if code := health(); code != http.StatusServiceUnavailable {
+		t.Errorf("got %d before the first scrape, want 503", code)
+	}
+
+	c.scrape()
+	if code := health(); code != http.StatusOK {
+		t.Errorf("got %d after the first scrape, want 200", code)
+	}
+
+	// The breaker opens on the first failure, the account then being
+	// skipped with the result of its failed scrape.
+	atomic.StoreInt32(&failing, 1)
+	c.scrape()
+	if code := health(); code != http.StatusServiceUnavailable {
+		t.Errorf("got %d after a failed scrape, want 503", code)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	atomic.StoreInt32(&calls, 0)
+	c.scrape()
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("got %d calls with the breaker open, want none", n)
+	}
+	if code := health(); code != http.StatusServiceUnavailable {
+		t.Errorf("got %d with the breaker open, want 503", code)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// responseTimeBuckets are the buckets of pingdom_uptime_response_time_seconds,
+// doubling from 50ms to 25.6s, the tests reaching the 30s timeout of the
+// Pingdom checks falling in the +Inf bucket.
+var responseTimeBuckets = prometheus.ExponentialBuckets(0.05, 2, 10)
+
+// observedTest is the time of the last test of a check observed by
+// pingdom_uptime_response_time_seconds, and the labels of its series.
+type observedTest struct {
+	lastTest int64
+	labels   prometheus.Labels
+}
+
+// responseTimeTests keeps the last test observed for each check, so that a
+// test isn't observed again when the check wasn't tested since the previous
+// scrape. Unlike the other metrics of the checks, the series of the
+// histogram are kept across the scrapes, and only deleted along with the
+// checks.
+type responseTimeTests struct {
+	mutex sync.Mutex
+	tests map[checkKey]observedTest
+}
+
+// observedResponseTimes are the tests observed with
+// --enable-response-time-histogram.
+var observedResponseTimes = &responseTimeTests{tests: map[checkKey]observedTest{}}
+
+// observe observes the response time of the last test of check in
+// pingdom_uptime_response_time_seconds, once per test, with its check_id as
+// exemplar to find the test in Pingdom.
+func (r *responseTimeTests) observe(acc account, check checkResponse) {
+	if check.LastTestTime == 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := checkKey{account: acc.name, id: check.ID}
+	labels := prometheus.Labels{"account": acc.name, "name": check.Name, "hostname": check.Hostname}
+	previous, ok := r.tests[key]
+	if ok && previous.lastTest == check.LastTestTime {
+		return
+	}
+	// A renamed check starts a new series.
+	if ok && (previous.labels["name"] != check.Name || previous.labels["hostname"] != check.Hostname) {
+		pingdomCheckResponseTimeHistogram.Delete(previous.labels)
+	}
+	r.tests[key] = observedTest{lastTest: check.LastTestTime, labels: labels}
+
+	observer := pingdomCheckResponseTimeHistogram.With(labels)
+	seconds := float64(check.LastResponseTime) / 1000
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+		eo.ObserveWithExemplar(seconds, prometheus.Labels{"check_id": strconv.Itoa(check.ID)})
+		return
+	}
+	observer.Observe(seconds)
+}
+
+// prune deletes the series of the checks of account whose ids aren't in ids,
+// e.g. deleted or paused ones.
+func (r *responseTimeTests) prune(account string, ids map[int]bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for key, test := range r.tests {
+		if key.account == account && !ids[key.id] {
+			pingdomCheckResponseTimeHistogram.Delete(test.labels)
+			delete(r.tests, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestResponseTimeHistogram(t *testing.T) {
+	previous := enableResponseTimeHistogram
+	defer func() { enableResponseTimeHistogram = previous }()
+	enableResponseTimeHistogram = true
+
+	bodies := map[string]string{
+		"/checks": `{"checks": [{"id": 1, "name": "web", "hostname": "example.com", "status": "up", "lastresponsetime": 250, "lasttesttime": 1600000000}]}`,
+	}
+	acc, cleanup := newTestAccount(t, "histogram", bodies)
+	defer cleanup()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(pingdomCheckResponseTimeHistogram)
+	scrape := func() string {
+		t.Helper()
+
+		if _, err := retrieveChecksMetrics(context.Background(), acc); err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		rec := httptest.NewRecorder()
+		metricsHandler(registry).ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	count := `pingdom_uptime_response_time_seconds_count{account="histogram",hostname="example.com",name="web"} `
+
+	// The same test is only observed once.
+	scrape()
+	body := scrape()
+	if !strings.Contains(body, count+"1\n") {
+		t.Errorf("got %s, want 1 observation", body)
+	}
+	if !strings.Contains(body, `pingdom_uptime_response_time_seconds_bucket{account="histogram",hostname="example.com",name="web",le="0.4"} 1 # {check_id="1"} 0.25 `) {
+		t.Errorf("got %s, want the check_id exemplar in the 0.4 bucket", body)
+	}
+
+	bodies["/checks"] = `{"checks": [{"id": 1, "name": "web", "hostname": "example.com", "status": "up", "lastresponsetime": 1000, "lasttesttime": 1600000060}]}`
+	if body := scrape(); !strings.Contains(body, count+"2\n") {
+		t.Errorf("got %s, want 2 observations after a new test", body)
+	}
+
+	bodies["/checks"] = `{"checks": []}`
+	if body := scrape(); strings.Contains(body, count) {
+		t.Errorf("got %s, want the series of the deleted check to be deleted", body)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requiredLabels lists the labels of the check metrics that can't be
+// disabled, as they identify the checks.
+var requiredLabels = map[string]bool{
+	"account": true,
+	"name":    true,
+}
+
+var (
+	disabledLabels string
+	includeCheckID bool
+)
+
+// checkGaugeVec is a prometheus.GaugeVec of check metrics whose labels can
+// be disabled with --disable-labels. The labels must be disabled before the
+// metric is registered.
+type checkGaugeVec struct {
+	*prometheus.GaugeVec
+	opts   prometheus.GaugeOpts
+	labels []string
+}
+
+func newCheckGaugeVec(opts prometheus.GaugeOpts, labels []string) *checkGaugeVec {
+	return &checkGaugeVec{
+		GaugeVec: prometheus.NewGaugeVec(opts, labels),
+		opts:     opts,
+		labels:   labels,
+	}
+}
+
+// disableLabels drops the disabled labels from the metric definition.
+func (v *checkGaugeVec) disableLabels(disabled map[string]bool) {
+	var labels []string
+	for _, label := range v.labels {
+		if !disabled[label] {
+			labels = append(labels, label)
+		}
+	}
+
+	v.labels = labels
+	v.GaugeVec = prometheus.NewGaugeVec(v.opts, labels)
+}
+
+// with returns the gauge for the given labels, ignoring the disabled ones.
+func (v *checkGaugeVec) with(labels prometheus.Labels) prometheus.Gauge {
+	enabled := make(prometheus.Labels, len(v.labels))
+	for _, label := range v.labels {
+		enabled[label] = labels[label]
+	}
+
+	return v.GaugeVec.With(enabled)
+}
+
+// disableCheckLabels drops the labels of --disable-labels from
+// pingdom_uptime_status and pingdom_uptime_response_time, along with the id
+// without --include-check-id and the group without --group-tag-prefix.
+func disableCheckLabels() error {
+	disabled, err := parseDisabledLabels(disabledLabels, pingdomCheckStatus, pingdomCheckResponseTime)
+	if err != nil {
+		return err
+	}
+	if !includeCheckID {
+		disabled["id"] = true
+	}
+	if groupTagPrefix == "" {
+		disabled["group"] = true
+	}
+
+	pingdomCheckStatus.disableLabels(disabled)
+	pingdomCheckResponseTime.disableLabels(disabled)
+	return nil
+}
+
+// parseDisabledLabels parses the comma-separated labels of --disable-labels,
+// which must be optional labels of one of vecs.
+func parseDisabledLabels(s string, vecs ...*checkGaugeVec) (map[string]bool, error) {
+	known := map[string]bool{}
+	for _, v := range vecs {
+		for _, label := range v.labels {
+			known[label] = !requiredLabels[label]
+		}
+	}
+
+	disabled := map[string]bool{}
+	for _, label := range strings.Split(s, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if !known[label] {
+			return nil, fmt.Errorf("invalid label %q in --disable-labels", label)
+		}
+		disabled[label] = true
+	}
+
+	return disabled, nil
+}
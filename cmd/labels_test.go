@@ -0,0 +1,135 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseDisabledLabels(t *testing.T) {
+	vec := newCheckGaugeVec(prometheus.GaugeOpts{Name: "pingdom_test", Help: "Test."}, []string{"account", "name", "hostname", "tags"})
+
+	tests := []struct {
+		flag    string
+		want    string
+		wantErr bool
+	}{
+		{"", "map[]", false},
+		{"tags", "map[tags:true]", false},
+		{" tags , hostname,", "map[hostname:true tags:true]", false},
+		{"name", "", true},
+		{"account", "", true},
+		{"unknown", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseDisabledLabels(tt.flag, vec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDisabledLabels(%q) error = %v, want error %v", tt.flag, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && fmt.Sprint(got) != tt.want {
+			t.Errorf("parseDisabledLabels(%q) = %v, want %s", tt.flag, got, tt.want)
+		}
+	}
+}
+
+func TestCheckGaugeVecDisableLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled map[string]bool
+		labels   string
+		want     string
+	}{
+		{"none", nil, "[account name hostname paused tags]", "hostname=example.com,name=web,paused=false,tags=team-a"},
+		{"tags", map[string]bool{"tags": true}, "[account name hostname paused]", "hostname=example.com,name=web,paused=false"},
+		{"several", map[string]bool{"tags": true, "paused": true, "hostname": true}, "[account name]", "name=web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vec := newCheckGaugeVec(prometheus.GaugeOpts{Name: "pingdom_test", Help: "Test."}, []string{"account", "name", "hostname", "paused", "tags"})
+			vec.disableLabels(tt.disabled)
+
+			// The disabled labels are dropped from the description, so that
+			// the metric is registered without them.
+			ch := make(chan *prometheus.Desc, 1)
+			vec.Describe(ch)
+			if desc := (<-ch).String(); !strings.HasSuffix(desc, "variableLabels: "+tt.labels+"}") {
+				t.Errorf("got %s, want the labels %s", desc, tt.labels)
+			}
+			registry := prometheus.NewRegistry()
+			if err := registry.Register(vec); err != nil {
+				t.Fatal(err)
+			}
+
+			vec.with(prometheus.Labels{
+				"account":  "labels",
+				"name":     "web",
+				"hostname": "example.com",
+				"paused":   "false",
+				"tags":     "team-a",
+			}).Set(1)
+
+			want := map[string]float64{tt.want: 1}
+			if got := series(vec, "labels"); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got series %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDisableCheckLabelsCheckID(t *testing.T) {
+	defer func(labels string, id bool) { disabledLabels, includeCheckID = labels, id }(disabledLabels, includeCheckID)
+	status, responseTime := *pingdomCheckStatus, *pingdomCheckResponseTime
+	defer func() { *pingdomCheckStatus, *pingdomCheckResponseTime = status, responseTime }()
+	disabledLabels = "hostname,resolution,paused,tags,type,probe_region"
+
+	acc, cleanup := newTestAccount(t, "check-id", map[string]string{
+		"/checks": `{"checks": [{"id": 42, "name": "web", "hostname": "example.com", "status": "up", "lastresponsetime": 120}]}`,
+	})
+	defer cleanup()
+
+	tests := []struct {
+		name         string
+		id           bool
+		status       map[string]float64
+		responseTime map[string]float64
+	}{
+		{"without id", false, map[string]float64{"name=web": 1}, map[string]float64{"name=web": 120}},
+		{"with id", true, map[string]float64{"id=42,name=web": 1}, map[string]float64{"id=42,name=web": 120}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includeCheckID = tt.id
+			*pingdomCheckStatus, *pingdomCheckResponseTime = status, responseTime
+			if err := disableCheckLabels(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := retrieveChecksMetrics(context.Background(), acc); err != nil {
+				t.Fatal(err)
+			}
+			if got := series(pingdomCheckStatus, acc.name); fmt.Sprint(got) != fmt.Sprint(tt.status) {
+				t.Errorf("got pingdom_uptime_status %v, want %v", got, tt.status)
+			}
+			if got := series(pingdomCheckResponseTime, acc.name); fmt.Sprint(got) != fmt.Sprint(tt.responseTime) {
+				t.Errorf("got pingdom_uptime_response_time %v, want %v", got, tt.responseTime)
+			}
+		})
+	}
+}
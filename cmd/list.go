@@ -0,0 +1,122 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/prometheus/common/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listCmd = &cobra.Command{
+		Use:   "list [username] [password] [api-key] [account-email]",
+		Short: "List the checks",
+		Long: `List the checks of the Pingdom accounts and exit.
+
+The accounts are configured like with the server command.`,
+		Args: cobra.MaximumNArgs(4),
+		Run:  listRun,
+	}
+
+	listOutput string
+)
+
+// listedCheck is a check printed by the list command.
+type listedCheck struct {
+	Account  string   `json:"account"`
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Hostname string   `json:"hostname"`
+	Type     string   `json:"type"`
+	Status   string   `json:"status"`
+	Tags     []string `json:"tags"`
+}
+
+func init() {
+	RootCmd.AddCommand(listCmd)
+
+	addAccountFlags(listCmd.Flags())
+	listCmd.Flags().StringVar(&listOutput, "output", "table", "output format, either table or json")
+}
+
+func listRun(cmd *cobra.Command, args []string) {
+	accounts := setupAccounts(cmd, args)
+
+	if listOutput != "table" && listOutput != "json" {
+		log.Fatalf("Invalid output %q, must be table or json", listOutput)
+	}
+
+	failed := false
+	checks := []listedCheck{}
+	for _, acc := range accounts {
+		accountChecks, err := listAllChecks(context.Background(), acc.client, checkParams())
+		if err != nil {
+			apiLogger(acc, err).Errorln(apiErrorMessage(err, "Error getting checks"))
+			failed = true
+			continue
+		}
+
+		for _, check := range filterChecks(accountChecks) {
+			tags := []string{}
+			for _, tag := range check.Tags {
+				tags = append(tags, tag.Name)
+			}
+
+			checks = append(checks, listedCheck{
+				Account:  acc.name,
+				ID:       check.ID,
+				Name:     check.Name,
+				Hostname: check.Hostname,
+				Type:     check.Type.Name,
+				Status:   check.Status,
+				Tags:     tags,
+			})
+		}
+	}
+
+	if listOutput == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tID\tNAME\tHOSTNAME\tTYPE\tSTATUS\tTAGS")
+		for _, check := range checks {
+			fmt.Fprintln(w, strings.Join([]string{
+				check.Account,
+				strconv.Itoa(check.ID),
+				check.Name,
+				check.Hostname,
+				check.Type,
+				check.Status,
+				strings.Join(check.Tags, ","),
+			}, "\t"))
+		}
+		w.Flush()
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
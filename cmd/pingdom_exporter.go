@@ -14,11 +14,54 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/prometheus/common/log"
 	"github.com/spf13/cobra"
 )
 
 // RootCmd is the main Cobra Command.
 var RootCmd = &cobra.Command{
-	Use:   "pingdom_exporter",
-	Short: "pingdom_exporter exports Pingdom metrics to Prometheus",
+	Use:               "pingdom_exporter",
+	Short:             "pingdom_exporter exports Pingdom metrics to Prometheus",
+	PersistentPreRunE: setupLogger,
+}
+
+var (
+	logFormat string
+	logLevel  string
+)
+
+// logFlagNames lists the flags configuring the logger, read from the
+// configuration before the others so that their logs are configured too.
+var logFlagNames = map[string]bool{
+	"log-format": true,
+	"log-level":  true,
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "format of the logs, either text or json")
+	RootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "minimum level of the logs, either debug, info, warn, error or fatal")
+}
+
+// setupLogger configures the logger according to the --log-format and
+// --log-level flags, which fall back to the environment and the --config
+// file like the others.
+func setupLogger(cmd *cobra.Command, args []string) error {
+	if _, err := loadConfig(cmd, logFlagNames); err != nil {
+		return err
+	}
+
+	if err := log.Base().SetLevel(logLevel); err != nil {
+		return fmt.Errorf("invalid log level %q, must be debug, info, warn, error or fatal", logLevel)
+	}
+
+	switch logFormat {
+	case "text":
+		return nil
+	case "json":
+		return log.Base().SetFormat("logger:stderr?json=true")
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", logFormat)
+	}
 }
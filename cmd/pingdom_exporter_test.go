@@ -0,0 +1,74 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestSetupLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pingdom_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		logFormat, logLevel = "text", "info"
+		_ = log.Base().SetLevel(logLevel)
+	}()
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		config  string
+		level   string
+		wantErr bool
+	}{
+		{"defaults", nil, "", "info", false},
+		{"environment", map[string]string{"PINGDOM_LOG_LEVEL": "debug"}, "", "debug", false},
+		{"config file", nil, "log-level: warn\n", "warn", false},
+		{"environment over config file", map[string]string{"PINGDOM_LOG_LEVEL": "error"}, "log-level: warn\n", "error", false},
+		{"invalid level", map[string]string{"PINGDOM_LOG_LEVEL": "verbose"}, "", "", true},
+		{"invalid format", nil, "log-format: xml\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, reset := newTestCommand()
+			defer reset()
+			cmd.Flags().AddFlagSet(RootCmd.PersistentFlags())
+
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			if tt.config != "" {
+				if err := cmd.Flags().Set("config", writeConfig(t, dir, tt.config)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := setupLogger(cmd, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setupLogger() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && logLevel != tt.level {
+				t.Errorf("got --log-level %q, want %q", logLevel, tt.level)
+			}
+		})
+	}
+}
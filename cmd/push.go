@@ -0,0 +1,105 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	pushGatewayURL string
+	pushJob        string
+	pushGrouping   []string
+)
+
+// parsePushGrouping parses the key=value grouping labels of
+// --push-grouping.
+func parsePushGrouping(grouping []string) (map[string]string, error) {
+	labels := make(map[string]string, len(grouping))
+	for _, label := range grouping {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid push grouping label %q, must be key=value", label)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return labels, nil
+}
+
+// validatePushFlags returns an error if the --push-* flags are invalid.
+func validatePushFlags() error {
+	if pushGatewayURL == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(pushGatewayURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid Pushgateway URL %q, must be an absolute URL", pushGatewayURL)
+	}
+	if pushJob == "" {
+		return errors.New("the push job name can't be empty")
+	}
+	_, err := parsePushGrouping(pushGrouping)
+
+	return err
+}
+
+// newPusher returns the pusher of the metrics of g to the Pushgateway at
+// --push-gateway-url, under --push-job and the --push-grouping labels. The
+// credentials of the URL, if any, are sent with HTTP Basic Auth.
+func newPusher(g prometheus.Gatherer) *push.Pusher {
+	u, _ := url.Parse(pushGatewayURL)
+	var username, password string
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+		u.User = nil
+	}
+
+	pusher := push.New(u.String(), pushJob).Gatherer(g)
+	if username != "" {
+		pusher = pusher.BasicAuth(username, password)
+	}
+
+	grouping, _ := parsePushGrouping(pushGrouping)
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+
+	return pusher
+}
+
+// pushLoop pushes the metrics with pusher every interval, each push
+// scraping the Pingdom API once the metrics of the previous scrape are
+// older than --wait. A failed push is logged and retried on the next one.
+func pushLoop(pusher *push.Pusher, interval time.Duration) {
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	for {
+		if err := pusher.Push(); err != nil {
+			log.With("err", err).Errorln("Error pushing the metrics to the Pushgateway")
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestPusher(t *testing.T) {
+	previousURL, previousJob, previousGrouping := pushGatewayURL, pushJob, pushGrouping
+	defer func() { pushGatewayURL, pushJob, pushGrouping = previousURL, previousJob, previousGrouping }()
+
+	var (
+		status   int
+		method   string
+		path     string
+		username string
+		password string
+		families map[string]*dto.MetricFamily
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		username, password, _ = r.BasicAuth()
+
+		families = map[string]*dto.MetricFamily{}
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); err != nil {
+				if err != io.EOF {
+					t.Errorf("error decoding the pushed metrics: %v", err)
+				}
+				break
+			}
+			families[mf.GetName()] = &mf
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "pingdom_test", Help: "Test."})
+	gauge.Set(42)
+	registry.MustRegister(gauge)
+
+	pushGatewayURL = strings.Replace(srv.URL, "http://", "http://admin:secret@", 1)
+	pushJob = "pingdom"
+	pushGrouping = []string{"env=prod"}
+
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusAccepted, false},
+		{http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		err := newPusher(registry).Push()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Push() with a %d response error = %v, want error %v", tt.status, err, tt.wantErr)
+		}
+
+		if method != http.MethodPut || path != "/metrics/job/pingdom/env/prod" {
+			t.Errorf("got %s %s, want PUT /metrics/job/pingdom/env/prod", method, path)
+		}
+		if username != "admin" || password != "secret" {
+			t.Errorf("got credentials %q:%q, want those of the URL", username, password)
+		}
+		mf, ok := families["pingdom_test"]
+		if !ok || len(mf.Metric) != 1 || mf.Metric[0].GetGauge().GetValue() != 42 {
+			t.Errorf("got pushed metrics %v, want pingdom_test 42", families)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/common/log"
+)
+
+// reloadHandler calls reload on POST requests, re-reading the configuration
+// and rebuilding the Pingdom clients. Without HTTP Basic Auth, only the
+// requests from the loopback interface are allowed.
+func reloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if authUsername == "" || authPassword == "" {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		if err := reload(); err != nil {
+			log.With("err", err).Errorln("Error reloading the configuration")
+			http.Error(w, fmt.Sprintf("Error reloading the configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		log.Infoln("Reloaded the configuration")
+		fmt.Fprintln(w, "OK")
+	}
+}
@@ -14,84 +14,611 @@
 package cmd
 
 import (
-	"flag"
+	"context"
 	"fmt"
+	"html"
+	"io"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"github.com/strike-team/go-pingdom/pingdom"
 )
 
+// shutdownTimeout is the time given to the in-flight requests to complete
+// when the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
+// maxErrorLength is the maximum length of the error descriptions used as
+// label values, bounding their cardinality.
+const maxErrorLength = 100
+
 var (
 	serverCmd = &cobra.Command{
-		Use:   "server [username] [password] [api-key]",
+		Use:   "server [username] [password] [api-key] [account-email]",
 		Short: "Start the HTTP server",
-		Run:   serverRun,
+		Long: `Start the HTTP server.
+
+The Pingdom credentials are read from the positional arguments. Any argument
+that is not given falls back to its environment variable, then to its key in
+the --config file:
+
+  username       PINGDOM_USERNAME       username
+  password       PINGDOM_PASSWORD       password
+  api-key        PINGDOM_API_KEY        api-key
+  account-email  PINGDOM_ACCOUNT_EMAIL  account-email (multi-user accounts only)
+
+Alternatively, the account can be authenticated with a bearer token given with
+--api-token (PINGDOM_API_TOKEN), in which case the positional arguments are
+ignored.
+
+Several accounts can be scraped by repeating the --account flag, or with the
+accounts list of the --config file, in which case the metrics are labeled with
+the name of their account.
+
+Likewise, the flags that are not given fall back to their PINGDOM_* environment
+variable (e.g. PINGDOM_WAIT or PINGDOM_WEB_AUTH_USERNAME), then to their key in
+the --config file. --port has no environment variable, as PINGDOM_PORT is set
+by Kubernetes for a Service named pingdom: use --web.listen-address instead.`,
+		Args: cobra.MaximumNArgs(4),
+		Run:  serverRun,
 	}
 
-	waitSeconds int
-	port        int
+	waitSeconds            int
+	waitJitterSeconds      int
+	port                   int
+	tags                   string
+	tagsMatch              string
+	metricsPath            string
+	metricNamespace        string
+	instanceID             string
+	instanceIDFromHostname bool
+	oneshot                bool
+	waitFirstScrape        bool
+
+	maxTags      int
+	maxTagLength int
+	userIDs      string
+	includeTags  bool
+	excludeFlag  string
+	skipPaused   bool
+
+	responseTimeUpOnly bool
+	normalizeHostnames bool
+
+	baselineWindow              int
+	enableResponseTimeHistogram bool
+
+	authUsername string
+	authPassword string
+
+	tlsCertFile string
+	tlsKeyFile  string
+
+	responseHeaders []string
+	listenAddress   string
+
+	enablePprof        bool
+	disableCompression bool
+	enableAdminAPI     bool
+
+	scrapeTimeoutSeconds int
+	maxRetries           int
+	maxAuthFailures      int
+	maxConcurrency       int
+	pageLimit            int
+	apiURL               string
+	apiToken             string
+	apiRateLimit         float64
+	apiUserAgent         string
+
+	circuitBreakerThreshold int
+	circuitBreakerSeconds   int
+
+	httpMaxIdleConnsPerHost    int
+	httpIdleConnTimeoutSeconds int
+	httpDisableKeepAlives      bool
+	httpDisableHTTP2           bool
+
+	enableSLA      bool
+	slaWindowDays  int
+	slaWaitSeconds int
+	slaTagPrefix   string
+
+	groupTagPrefix string
+
+	enableCheckDetails bool
+	enableLastError    bool
+
+	enablePerformance      bool
+	performanceWindowHours int
+	enableMaintenance      bool
+
+	enableAccountMetrics bool
+	enableRegionMetrics  bool
+	enableCheckOwners    bool
+	enableProbes         bool
+	probesOnlyActive     bool
+
+	enableTransactionSteps bool
+
+	disableChecks       bool
+	disableTransactions bool
 
-	pingdomUp = prometheus.NewGauge(prometheus.GaugeOpts{
+	pingdomBuildInfo = version.NewCollector("pingdom_exporter")
+
+	pingdomUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pingdom_up",
-		Help: "Whether the last pingdom scrape was successfull (1: up, 0: down)",
-	})
+		Help: "Whether the last pingdom scrape of the endpoint was successfull (1: up, 0: down)",
+	}, []string{"account", "endpoint"})
+
+	pingdomAccountUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_account_up",
+		Help: "Whether the last scrape of all the endpoints of the account was successful (1: up, 0: down)",
+	}, []string{"account"})
+
+	pingdomConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_consecutive_scrape_failures",
+		Help: "The number of consecutive failed scrapes of the endpoint, 0 after a successful one",
+	}, []string{"account", "endpoint"})
+
+	pingdomScrapeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_scrape_duration_seconds",
+		Help: "The duration of the last scrape of the Pingdom API in seconds",
+	}, []string{"account", "resource"})
+
+	pingdomLastScrape = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_last_scrape_timestamp_seconds",
+		Help: "The time of the last successful scrape of the Pingdom API as a Unix timestamp",
+	}, []string{"account"})
+
+	pingdomCircuitBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_circuit_breaker_open",
+		Help: "Whether the scrapes of the account are suspended after consecutive failures (1: open, 0: closed)",
+	}, []string{"account"})
+
+	pingdomAuthFailure = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_auth_failure",
+		Help: "Whether the last scrape failed to authenticate to the Pingdom API (1: failed, 0: succeeded)",
+	}, []string{"account"})
+
+	pingdomAPIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pingdom_api_requests_total",
+		Help: "The number of calls to the Pingdom API",
+	}, []string{"account", "endpoint", "result"})
+
+	pingdomScrapeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pingdom_scrape_errors_total",
+		Help: "The number of failed scrapes of the Pingdom API",
+	}, []string{"account", "endpoint", "class"})
+
+	pingdomAPIThrottleWait = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_api_rate_limit_wait_seconds",
+		Help: "The time the last call to the Pingdom API waited for --api-rate-limit in seconds",
+	}, []string{"account"})
+
+	pingdomRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pingdom_rate_limited_total",
+		Help: "The number of calls to the Pingdom API rejected with a 429 status",
+	}, []string{"account"})
 
-	pingdomCheckStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	pingdomRateLimitShort = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_rate_limit_remaining_short",
+		Help: "The number of remaining requests in the short term Pingdom API rate limit",
+	}, []string{"account"})
+
+	pingdomRateLimitLong = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_rate_limit_remaining_long",
+		Help: "The number of remaining requests in the long term Pingdom API rate limit",
+	}, []string{"account"})
+
+	pingdomChecksTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_checks_total",
+		Help: "The number of checks returned by the last scrape",
+	}, []string{"account"})
+
+	pingdomChecksDown = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_checks_down_total",
+		Help: "The number of checks down or unconfirmed down in the last scrape",
+	}, []string{"account"})
+
+	pingdomChecksPaused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_checks_paused_total",
+		Help: "The number of paused checks in the last scrape",
+	}, []string{"account"})
+
+	pingdomChecksByType = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_checks_by_type_total",
+		Help: "The number of checks of each type in the last scrape",
+	}, []string{"account", "type"})
+
+	pingdomTagsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_tags_total",
+		Help: "The number of distinct tags of the checks returned by the last scrape",
+	}, []string{"account"})
+
+	pingdomTransactionsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_transactions_total",
+		Help: "The number of transactions returned by the last scrape",
+	}, []string{"account"})
+
+	pingdomCheckStatus = newCheckGaugeVec(prometheus.GaugeOpts{
 		Name: "pingdom_uptime_status",
 		Help: "The current status of the check (1: up, 0: down)",
-	}, []string{"name", "hostname", "resolution", "paused", "tags"})
+	}, []string{"account", "name", "id", "hostname", "resolution", "paused", "tags", "type", "group"})
+
+	pingdomCheckUnknownStatus = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pingdom_uptime_check_unknown_status_total",
+		Help: "The number of times a check was found with a status unknown to the exporter",
+	}, []string{"account", "status"})
 
-	pingdomCheckResponseTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	pingdomCheckStatusByRegion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_status_by_region",
+		Help: "The status of the last test of the check from the probe region in the last hour",
+	}, []string{"account", "name", "region"})
+
+	pingdomCheckResponseTime = newCheckGaugeVec(prometheus.GaugeOpts{
 		Name: "pingdom_uptime_response_time",
 		Help: "The response time of last test in milliseconds",
-	}, []string{"name", "hostname", "resolution", "paused", "tags"})
+	}, []string{"account", "name", "id", "hostname", "resolution", "paused", "tags", "type", "probe_region"})
+
+	pingdomCheckInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_info",
+		Help: "Information about the check, always 1",
+	}, []string{"account", "name", "hostname", "type", "last_error"})
+
+	pingdomCheckStatusInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_status_info",
+		Help: "The current status of the check as reported by Pingdom, always 1",
+	}, []string{"account", "name", "hostname", "status"})
+
+	pingdomCheckPaused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_paused",
+		Help: "Whether the check is paused (1: paused, 0: active)",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckTag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_tag",
+		Help: "A tag of the check, always 1",
+	}, []string{"account", "name", "tag"})
+
+	pingdomCheckResolution = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_resolution_minutes",
+		Help: "The interval between two tests of the check in minutes",
+	}, []string{"account", "name"})
+
+	pingdomCheckCreated = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_created_timestamp",
+		Help: "The creation time of the check as a Unix timestamp",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckLastModified = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_last_modified_timestamp",
+		Help: "The last modification time of the check as a Unix timestamp",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckLastTest = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_last_test_timestamp",
+		Help: "The time of the last test of the check as a Unix timestamp",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckOverdue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_overdue",
+		Help: "Whether the check wasn't tested for more than twice its resolution (1: overdue, 0: on time)",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckSLA = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_sla_percentage",
+		Help: "The percentage of time the check was up over the SLA window",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckSLATarget = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_sla_target_percentage",
+		Help: "The SLA target of the check in percent, from its --sla-tag-prefix tag",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckDowntime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_downtime_seconds_total",
+		Help: "The time the check was down over the SLA window in seconds",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckResponseTimeBaseline = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_response_time_baseline_ms",
+		Help: "The average response time of the previous tests of the check while up in milliseconds",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckResponseTimeRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_response_time_ratio",
+		Help: "The ratio of the last response time of the check to its baseline",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckResponseTimeHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pingdom_uptime_response_time_seconds",
+		Help:    "The response times of the tests of the check in seconds",
+		Buckets: responseTimeBuckets,
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckResponseTimeAvg = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_response_time_avg",
+		Help: "The average response time of the check over the performance window in milliseconds",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckContacts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_contacts",
+		Help: "The number of user contacts notified by the check",
+	}, []string{"account", "name"})
+
+	pingdomCheckIntegrations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_integrations",
+		Help: "The number of integrations notified by the check",
+	}, []string{"account", "name"})
+
+	pingdomCheckResponseTimeThreshold = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_response_time_threshold_ms",
+		Help: "The response time above which the check is considered down in milliseconds",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomCheckTargetInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_target_info",
+		Help: "The target of the check, with its IP address when the hostname is one and its raw hostname with --normalize-hostname",
+	}, []string{"account", "name", "hostname", "ip", "raw_hostname"})
+
+	pingdomAccountCheckLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_account_check_limit",
+		Help: "The maximum number of checks of the account",
+	}, []string{"account"})
+
+	pingdomAccountCheckUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_account_check_used",
+		Help: "The number of checks used out of the check limit of the account",
+	}, []string{"account"})
+
+	pingdomProbeInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_probe_info",
+		Help: "A Pingdom probe server, always 1",
+	}, []string{"account", "id", "country", "city", "region", "active"})
+
+	pingdomCheckOwnerInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_owner_info",
+		Help: "The user owning the check in a multi-user account, by name or by id if it has none",
+	}, []string{"account", "name", "owner"})
+
+	pingdomCheckStatusSince = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_uptime_check_status_since_timestamp",
+		Help: "The time the check got its current status, up or down, as a Unix timestamp",
+	}, []string{"account", "name", "hostname"})
+
+	pingdomMaintenanceWindowActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_maintenance_window_active",
+		Help: "Whether the maintenance window is currently active (1: active, 0: inactive)",
+	}, []string{"account", "name", "checks"})
+
+	pingdomMaintenanceWindowNextStart = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_maintenance_window_next_start_timestamp",
+		Help: "The start time of the earliest upcoming maintenance window of the check as a Unix timestamp",
+	}, []string{"account", "name", "check"})
 
 	pingdomTransactionStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pingdom_transaction_status",
 		Help: "The current status of the transaction (1: successful, 0: failing)",
-	}, []string{"name", "kitchen", "paused", "tags"})
+	}, []string{"account", "name", "kitchen", "paused", "tags"})
+
+	pingdomTransactionStepStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_transaction_step_status",
+		Help: "The status of the step of the transaction in its last run (1: successful, 0: failed)",
+	}, []string{"account", "name", "step", "step_index"})
+
+	pingdomTransactionStepError = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_transaction_step_error_info",
+		Help: "The error of the step of the transaction that failed its last run, always 1",
+	}, []string{"account", "name", "step", "step_index", "error"})
+
+	pingdomTransactionResponseTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_transaction_response_time",
+		Help: "The total response time of the last transaction run in milliseconds",
+	}, []string{"account", "name", "kitchen"})
+
+	pingdomTransactionInterval = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pingdom_transaction_interval_minutes",
+		Help: "The interval between two runs of the transaction in minutes",
+	}, []string{"account", "name"})
 )
 
 func init() {
 	RootCmd.AddCommand(serverCmd)
 
-	serverCmd.Flags().IntVar(&waitSeconds, "wait", 10, "time (in seconds) between accessing the Pingdom  API")
+	addAccountFlags(serverCmd.Flags())
+	serverCmd.Flags().IntVar(&waitSeconds, "wait", 10, "minimum time (in seconds) between accessing the Pingdom API")
+	serverCmd.Flags().IntVar(&waitJitterSeconds, "wait-jitter", 0, "maximum time (in seconds) by which --wait is randomly shortened or lengthened")
 	serverCmd.Flags().IntVar(&port, "port", 9158, "port to listen on")
+	serverCmd.Flags().StringVar(&listenAddress, "web.listen-address", "", "address to listen on, e.g. 127.0.0.1:9158, taking precedence over --port")
+	serverCmd.Flags().IntVar(&maxAuthFailures, "max-auth-failures", 0, "number of consecutive scrapes failing to authenticate to the Pingdom API after which to exit, 0 to never exit")
+	serverCmd.Flags().IntVar(&circuitBreakerThreshold, "circuit-breaker-threshold", 0, "number of consecutive failed scrapes of an account after which to stop calling the Pingdom API for --circuit-breaker-duration, 0 to never stop")
+	serverCmd.Flags().IntVar(&circuitBreakerSeconds, "circuit-breaker-duration", 300, "time (in seconds) during which an account is not scraped once its circuit breaker is open")
+	serverCmd.Flags().IntVar(&maxConcurrency, "max-concurrency", 4, "maximum number of accounts scraped concurrently")
+	serverCmd.Flags().StringVar(&instanceID, "instance-id", "", "instance_id label of the scrape metrics, e.g. the pod name to tell replicas apart")
+	serverCmd.Flags().BoolVar(&instanceIDFromHostname, "instance-id-from-hostname", false, "use the HOSTNAME environment variable, the pod name on Kubernetes, as --instance-id when it is not set")
+	serverCmd.Flags().StringVar(&metricNamespace, "metric-namespace", "", "namespace prefixing the names of the Pingdom metrics, e.g. acme for acme_pingdom_up")
+	serverCmd.Flags().StringVar(&pushGatewayURL, "push-gateway-url", "", "URL of a Pushgateway to push the metrics to after each scrape, on top of serving them")
+	serverCmd.Flags().StringVar(&pushJob, "push-job", "pingdom_exporter", "job name under which to push the metrics with --push-gateway-url")
+	serverCmd.Flags().StringArrayVar(&pushGrouping, "push-grouping", nil, "key=value grouping label of the metrics pushed with --push-gateway-url (repeatable)")
+	serverCmd.Flags().BoolVar(&waitFirstScrape, "wait-for-first-scrape", false, "scrape the Pingdom API before listening, so that the metrics are available as soon as the HTTP server is")
+	serverCmd.Flags().BoolVar(&oneshot, "oneshot", false, "scrape the Pingdom API once, print the metrics to stdout and exit")
+	serverCmd.Flags().StringVar(&metricsPath, "metrics-path", "/metrics", "path under which to expose the metrics")
+	serverCmd.Flags().BoolVar(&enableSLA, "enable-sla", false, "export the uptime SLA of each check, calling the Pingdom API once per check")
+	serverCmd.Flags().IntVar(&slaWindowDays, "sla-window", 30, "time window (in days) over which to compute the uptime SLA")
+	serverCmd.Flags().IntVar(&slaWaitSeconds, "sla-wait", 3600, "minimum time (in seconds) between retrieving the uptime SLA")
+	serverCmd.Flags().StringVar(&slaTagPrefix, "sla-tag-prefix", "sla:", "prefix of the check tags holding their SLA target in percent, empty to disable")
+	serverCmd.Flags().StringVar(&groupTagPrefix, "group-tag-prefix", "", "prefix of the check tags holding their group, added as the group label of pingdom_uptime_status, empty to disable")
+	serverCmd.Flags().BoolVar(&enablePerformance, "enable-performance", false, "export the average response time of each check, calling the Pingdom API once per check")
+	serverCmd.Flags().IntVar(&performanceWindowHours, "performance-window", 24, "time window (in hours) over which to average the response time")
+	serverCmd.Flags().BoolVar(&enableCheckDetails, "enable-check-details", false, "export the alerting configuration and the target of each check, calling the Pingdom API once per check")
+	serverCmd.Flags().BoolVar(&enableLastError, "enable-last-error", false, "export the last error of the checks that are down in pingdom_uptime_check_info, calling the Pingdom API once per down check and test")
+	serverCmd.Flags().BoolVar(&enableMaintenance, "enable-maintenance", false, "export the maintenance windows and whether they are active")
+	serverCmd.Flags().BoolVar(&enableRegionMetrics, "enable-region-metrics", false, "export the status of each check from each probe region, calling the Pingdom API once per check")
+	serverCmd.Flags().BoolVar(&enableCheckOwners, "enable-check-owners", false, "export the users owning each check in multi-user accounts, calling the Pingdom API once per user")
+	serverCmd.Flags().BoolVar(&enableAccountMetrics, "enable-account-metrics", false, "export the check limit of the account and its usage")
+	serverCmd.Flags().BoolVar(&enableProbes, "enable-probes", false, "export the probe servers of Pingdom and whether they are active")
+	serverCmd.Flags().BoolVar(&probesOnlyActive, "probes-only-active", false, "only export the active probe servers with --enable-probes")
+	serverCmd.Flags().BoolVar(&disableChecks, "disable-checks", false, "don't scrape the uptime checks")
+	serverCmd.Flags().BoolVar(&disableTransactions, "disable-transactions", false, "don't scrape the transactions")
+	serverCmd.Flags().BoolVar(&enableTransactionSteps, "enable-transaction-steps", false, "export the status of the steps of each transaction, calling the Pingdom API twice per transaction")
+	serverCmd.Flags().StringVar(&authUsername, "web.auth-username", "", "username required to access the metrics with HTTP Basic Auth")
+	serverCmd.Flags().StringVar(&authPassword, "web.auth-password", "", "password required to access the metrics with HTTP Basic Auth")
+	serverCmd.Flags().StringVar(&tlsCertFile, "web.tls-cert-file", "", "path to the TLS certificate file, serving HTTPS when set along with --web.tls-key-file")
+	serverCmd.Flags().StringVar(&tlsKeyFile, "web.tls-key-file", "", "path to the TLS private key file, serving HTTPS when set along with --web.tls-cert-file")
+	serverCmd.Flags().StringArrayVar(&responseHeaders, "web.response-header", nil, "key:value header to set on the HTTP responses, on top of Cache-Control: no-store (repeatable)")
+	serverCmd.Flags().BoolVar(&enablePprof, "web.enable-pprof", false, "expose the Go profiling endpoints under /debug/pprof/")
+	serverCmd.Flags().BoolVar(&enableAdminAPI, "web.enable-admin-api", false, "expose the endpoints pausing and unpausing the checks under /admin/, requires HTTP Basic Auth")
+	serverCmd.Flags().BoolVar(&disableCompression, "web.disable-compression", false, "never gzip the metrics, even when requested with Accept-Encoding")
+	serverCmd.Flags().IntVar(&maxTags, "max-tags", 0, "maximum number of tags in the tags label, 0 for no limit")
+	serverCmd.Flags().IntVar(&maxTagLength, "max-tag-length", 0, "maximum length of the tags label, 0 for no limit")
+	serverCmd.Flags().BoolVar(&responseTimeUpOnly, "response-time-up-only", false, "only export pingdom_uptime_response_time for the checks that are up")
+	serverCmd.Flags().IntVar(&baselineWindow, "response-time-baseline-window", 0, "number of tests over which to average the response time of each check as its baseline, 0 to disable")
+	serverCmd.Flags().BoolVar(&enableResponseTimeHistogram, "enable-response-time-histogram", false, "export pingdom_uptime_response_time_seconds, a histogram of the response times of the tests of each check, with the check_id of the last test as exemplar in the OpenMetrics format")
+	serverCmd.Flags().BoolVar(&normalizeHostnames, "normalize-hostname", false, "strip the scheme, port and path from the hostname label of the checks")
+	serverCmd.Flags().BoolVar(&skipPaused, "skip-paused", false, "don't export the metrics of the paused checks and inactive transactions")
+	serverCmd.Flags().StringVar(&disabledLabels, "disable-labels", "", "comma-separated labels to drop from pingdom_uptime_status and pingdom_uptime_response_time")
+	serverCmd.Flags().BoolVar(&includeCheckID, "include-check-id", false, "add the id label to pingdom_uptime_status and pingdom_uptime_response_time")
+	serverCmd.Flags().StringVar(&statusValuesFlag, "status-values", "", "comma-separated status=value pairs overriding the values of pingdom_uptime_status, \"other\" setting the value of the unlisted statuses (NaN by default)")
+}
 
-	prometheus.MustRegister(pingdomUp)
-	prometheus.MustRegister(pingdomCheckStatus)
-	prometheus.MustRegister(pingdomCheckResponseTime)
-	prometheus.MustRegister(pingdomTransactionStatus)
+// apiParams returns the query parameters shared by the Pingdom list calls.
+func apiParams() map[string]string {
+	params := map[string]string{
+		"include_tags": strconv.FormatBool(includeTags),
+	}
+
+	if filter := splitList(tags); len(filter) > 0 {
+		params["tags"] = strings.Join(filter, ",")
+	}
+
+	return params
 }
 
-func sleep() {
-	time.Sleep(time.Second * time.Duration(waitSeconds))
+// checkParams returns the query parameters of the Pingdom checks list call.
+func checkParams() map[string]string {
+	params := apiParams()
+	if ids := splitList(userIDs); len(ids) > 0 {
+		params["userids"] = strings.Join(ids, ",")
+	}
+
+	return params
 }
 
-func retrieveTransactionMetrics(client *pingdom.Client) {
-	params := map[string]string{
-		"include_tags": "true",
+// excludeChecks is the compiled --exclude-checks regular expression, nil
+// when not set.
+var excludeChecks *regexp.Regexp
+
+// filterChecks returns checks without those whose name or hostname match
+// --exclude-checks, and those missing one of the --tags with --tags-match
+// all.
+func filterChecks(checks []checkResponse) []checkResponse {
+	if excludeChecks == nil && tagsMatch != "all" {
+		return checks
+	}
+
+	filtered := checks[:0]
+	for _, check := range checks {
+		if excludeChecks != nil && (excludeChecks.MatchString(check.Name) || excludeChecks.MatchString(check.Hostname)) {
+			continue
+		}
+		if !hasAllTags(check.Tags) {
+			continue
+		}
+		filtered = append(filtered, check)
+	}
+
+	return filtered
+}
+
+// hasAllTags returns whether checkTags include all the --tags with
+// --tags-match all, the Pingdom API only filtering on any of them. It always
+// returns true with --tags-match any.
+func hasAllTags(checkTags []pingdom.CheckResponseTag) bool {
+	if tagsMatch != "all" {
+		return true
+	}
+
+	names := make(map[string]bool, len(checkTags))
+	for _, tag := range checkTags {
+		names[tag.Name] = true
+	}
+	for _, tag := range splitList(tags) {
+		if !names[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitList returns the non-empty elements of the comma-separated list s.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
 	}
-	tmsResults, err := client.Tms.List(params)
+
+	return list
+}
+
+// retrieveTransactionMetrics sets the transaction metrics of acc and returns
+// the retrieved transactions by id, without the inactive transactions with
+// --skip-paused.
+func retrieveTransactionMetrics(ctx context.Context, acc account) (map[int]transactionResponse, error) {
+	var tmsResults map[int]transactionResponse
+	err := withRetries(ctx, func() (err error) {
+		if acc.tokenAuth {
+			tmsResults, err = listTransactionChecks(ctx, acc.client, apiParams())
+		} else {
+			tmsResults, err = listTransactions(ctx, acc.client, apiParams())
+		}
+		return err
+	})
 	if err != nil {
-		log.Errorf("Error getting Tms: %v", err)
-		pingdomUp.Set(0)
+		apiLogger(acc, err).Errorln(apiErrorMessage(err, "Error getting Tms"))
+		pingdomUp.WithLabelValues(acc.name, "transactions").Set(0)
+		pingdomConsecutiveFailures.WithLabelValues(acc.name, "transactions").Inc()
+		pingdomScrapeErrors.WithLabelValues(acc.name, "transactions", errorClass(err)).Inc()
 
-		return
+		return nil, err
+	}
+	pingdomUp.WithLabelValues(acc.name, "transactions").Set(1)
+	pingdomConsecutiveFailures.WithLabelValues(acc.name, "transactions").Set(0)
+	deleteAccountSeries(transactionMetrics, acc.name)
+
+	for id, tms := range tmsResults {
+		if !hasAllTags(tms.Tags) {
+			delete(tmsResults, id)
+		}
 	}
-	pingdomUp.Set(1)
 
-	for _, tms := range tmsResults {
+	// The inactive transactions skipped with --skip-paused are still
+	// counted.
+	pingdomTransactionsTotal.WithLabelValues(acc.name).Set(float64(len(tmsResults)))
+
+	for id, tms := range tmsResults {
 		var status float64
 		switch tms.Status {
 		case "SUCCESSFUL":
@@ -104,52 +631,162 @@ func retrieveTransactionMetrics(client *pingdom.Client) {
 		if tms.Active == "NO" {
 			paused = "true"
 		}
+		if skipPaused && paused == "true" {
+			delete(tmsResults, id)
+			continue
+		}
 
 		var tagsRaw []string
 		for _, tag := range tms.Tags {
 			tagsRaw = append(tagsRaw, tag.Name)
 		}
-		tags := strings.Join(tagsRaw, ",")
+		tags := joinTags(acc, tms.Name, tagsRaw)
 
 		pingdomTransactionStatus.WithLabelValues(
+			acc.name,
 			tms.Name,
 			tms.Kitchen,
 			paused,
 			tags,
 		).Set(status)
+
+		// Transactions that haven't run yet have no response time.
+		if tms.LastResponseTime > 0 {
+			pingdomTransactionResponseTime.WithLabelValues(
+				acc.name,
+				tms.Name,
+				tms.Kitchen,
+			).Set(float64(tms.LastResponseTime))
+		}
+
+		if tms.Interval > 0 {
+			pingdomTransactionInterval.WithLabelValues(
+				acc.name,
+				tms.Name,
+			).Set(float64(tms.Interval))
+		}
 	}
+
+	return tmsResults, nil
 }
 
-func retrieveChecksMetrics(client *pingdom.Client) {
-	params := map[string]string{
-		"include_tags": "true",
+// retrieveTransactionStepsMetrics sets the step metrics of the transactions
+// of acc. The steps before the one the last run failed in are successful,
+// the following ones are reported as failed as they didn't run. Since this
+// calls the Pingdom API twice per transaction, a failing transaction is
+// logged and skipped without affecting pingdom_up.
+func retrieveTransactionStepsMetrics(ctx context.Context, acc account, transactions map[int]transactionResponse) {
+	for id, tms := range transactions {
+		steps, err := getTransactionSteps(ctx, acc.client, id)
+		if err != nil {
+			apiLogger(acc, err).With("transaction", tms.Name).Errorln("Error getting transaction steps")
+			continue
+		}
+
+		states, err := getTransactionStates(ctx, acc.client, id)
+		if err != nil {
+			apiLogger(acc, err).With("transaction", tms.Name).Errorln("Error getting transaction status report")
+			continue
+		}
+
+		failedStep := len(steps)
+		var message string
+		if len(states) > 0 {
+			last := states[len(states)-1]
+			if last.Status != "successful" && last.ErrorInStep >= 0 {
+				failedStep = last.ErrorInStep
+				message = last.Message
+			}
+		}
+
+		for i, step := range steps {
+			var status float64
+			if i < failedStep {
+				status = 1
+			}
+
+			pingdomTransactionStepStatus.WithLabelValues(
+				acc.name,
+				tms.Name,
+				step.Fn,
+				strconv.Itoa(i),
+			).Set(status)
+		}
+
+		if failedStep < len(steps) {
+			pingdomTransactionStepError.WithLabelValues(
+				acc.name,
+				tms.Name,
+				steps[failedStep].Fn,
+				strconv.Itoa(failedStep),
+				truncate(message, maxErrorLength),
+			).Set(1)
+		}
+	}
+}
+
+// apiErrorMessage returns msg, the message logged for err returned by the
+// Pingdom API, or a distinct one for the authentication errors as they need
+// to be fixed. The callers log it themselves, so that the source field of
+// the log is their line rather than that of a logging helper.
+func apiErrorMessage(err error, msg string) string {
+	if isAuthError(err) {
+		return "Authentication to the Pingdom API failed, check the credentials"
 	}
-	checks, err := client.Checks.List(params)
+
+	return msg
+}
+
+// apiLogger returns a logger with the account of acc and the context of err,
+// returned by the Pingdom API.
+func apiLogger(acc account, err error) log.Logger {
+	return withRequest(log.With("account", acc.name), err)
+}
+
+// retrieveChecksMetrics sets the uptime check metrics of acc and returns the
+// retrieved checks, without the paused checks with --skip-paused.
+func retrieveChecksMetrics(ctx context.Context, acc account) ([]checkResponse, error) {
+	checks, err := listAllChecks(ctx, acc.client, checkParams())
 	if err != nil {
-		log.Errorf("Error getting checks: %v", err)
-		pingdomUp.Set(0)
+		apiLogger(acc, err).Errorln(apiErrorMessage(err, "Error getting checks"))
+		pingdomUp.WithLabelValues(acc.name, "checks").Set(0)
+		pingdomConsecutiveFailures.WithLabelValues(acc.name, "checks").Inc()
+		pingdomScrapeErrors.WithLabelValues(acc.name, "checks", errorClass(err)).Inc()
 
-		return
+		return nil, err
+	}
+	pingdomUp.WithLabelValues(acc.name, "checks").Set(1)
+	pingdomConsecutiveFailures.WithLabelValues(acc.name, "checks").Set(0)
+	deleteAccountSeries(checkMetrics, acc.name)
+	checks = filterChecks(checks)
+	if normalizeHostnames {
+		for i := range checks {
+			checks[i].Hostname = normalizeHostname(checks[i].Hostname)
+		}
 	}
-	pingdomUp.Set(1)
 
+	regions := probeRegions(ctx, acc, checks)
+
+	var downChecks, pausedChecks int
+	typeChecks := map[string]int{}
+	tagNames := map[string]bool{}
+	scraped := make([]checkResponse, 0, len(checks))
 	for _, check := range checks {
-		var status float64
-		switch check.Status {
-		case "unknown":
-			status = 0
-		case "paused":
-			status = 0
-		case "up":
-			status = 1
-		case "unconfirmed_down":
-			status = 0
-		case "down":
-			status = 0
-		default:
-			status = 100
+		status, known := statusValue(check.Status)
+		if !known {
+			log.With("account", acc.name).With("check", check.Name).With("status", check.Status).Warnln("Unknown check status")
+			pingdomCheckUnknownStatus.WithLabelValues(acc.name, check.Status).Inc()
+		}
+		if check.Status == "down" || check.Status == "unconfirmed_down" {
+			downChecks++
 		}
 
+		checkType := check.Type.Name
+		if checkType == "" {
+			checkType = "unknown"
+		}
+		typeChecks[checkType]++
+
 		resolution := strconv.Itoa(check.Resolution)
 
 		paused := strconv.FormatBool(check.Paused)
@@ -158,62 +795,726 @@ func retrieveChecksMetrics(client *pingdom.Client) {
 		if check.Status == "paused" {
 			paused = "true"
 		}
+		var pausedValue float64
+		if paused == "true" {
+			pausedValue = 1
+			pausedChecks++
+		}
+		if skipPaused && paused == "true" {
+			continue
+		}
+		scraped = append(scraped, check)
+
+		pingdomCheckPaused.WithLabelValues(
+			acc.name,
+			check.Name,
+			check.Hostname,
+		).Set(pausedValue)
 
 		var tagsRaw []string
 		for _, tag := range check.Tags {
 			tagsRaw = append(tagsRaw, tag.Name)
+			tagNames[tag.Name] = true
+
+			pingdomCheckTag.WithLabelValues(
+				acc.name,
+				check.Name,
+				tag.Name,
+			).Set(1)
+
+			if target, ok := slaTarget(tag.Name); ok {
+				pingdomCheckSLATarget.WithLabelValues(
+					acc.name,
+					check.Name,
+					check.Hostname,
+				).Set(target)
+			}
 		}
-		tags := strings.Join(tagsRaw, ",")
+		tags := joinTags(acc, check.Name, tagsRaw)
 
-		pingdomCheckStatus.WithLabelValues(
+		labels := prometheus.Labels{
+			"account":    acc.name,
+			"name":       check.Name,
+			"id":         strconv.Itoa(check.ID),
+			"hostname":   check.Hostname,
+			"resolution": resolution,
+			"paused":     paused,
+			"tags":       tags,
+			"type":       checkType,
+			"group":      checkGroup(check.Tags),
+		}
+		pingdomCheckStatus.with(labels).Set(status)
+
+		// The response time of the checks that aren't up is usually 0 or
+		// the timeout, which can be left out with --response-time-up-only.
+		if !responseTimeUpOnly || check.Status == "up" {
+			labels["probe_region"] = probeRegion(regions, check.LastProbeID)
+			pingdomCheckResponseTime.with(labels).Set(float64(check.LastResponseTime))
+			if enableResponseTimeHistogram {
+				observedResponseTimes.observe(acc, check)
+			}
+		}
+
+		// The baseline is only fed with the response times of the checks
+		// that are up, which are meaningful.
+		if baselineWindow > 0 && check.Status == "up" {
+			responseTime := float64(check.LastResponseTime)
+			baseline, ok := responseTimeBaselines.update(acc.name, check.ID, responseTime, check.LastTestTime, baselineWindow)
+			if ok && baseline > 0 {
+				pingdomCheckResponseTimeBaseline.WithLabelValues(
+					acc.name,
+					check.Name,
+					check.Hostname,
+				).Set(baseline)
+
+				pingdomCheckResponseTimeRatio.WithLabelValues(
+					acc.name,
+					check.Name,
+					check.Hostname,
+				).Set(responseTime / baseline)
+			}
+		}
+
+		var lastError string
+		if enableLastError && check.Status == "down" {
+			lastError = lastCheckErrors.get(ctx, acc, check)
+		}
+
+		pingdomCheckInfo.WithLabelValues(
+			acc.name,
 			check.Name,
 			check.Hostname,
-			resolution,
-			paused,
-			tags,
-		).Set(status)
+			checkType,
+			lastError,
+		).Set(1)
 
-		pingdomCheckResponseTime.WithLabelValues(
+		pingdomCheckStatusInfo.WithLabelValues(
+			acc.name,
 			check.Name,
 			check.Hostname,
-			resolution,
-			paused,
-			tags,
-		).Set(float64(check.LastResponseTime))
+			check.Status,
+		).Set(1)
+
+		pingdomCheckResolution.WithLabelValues(
+			acc.name,
+			check.Name,
+		).Set(float64(check.Resolution))
+
+		// Checks without these fields are skipped rather than
+		// reported as created, modified or tested at the epoch.
+		if check.Created > 0 {
+			pingdomCheckCreated.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(float64(check.Created))
+		}
+
+		if check.LastModified > 0 {
+			pingdomCheckLastModified.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(float64(check.LastModified))
+		}
+
+		if check.LastTestTime > 0 {
+			pingdomCheckLastTest.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(float64(check.LastTestTime))
+
+			// Paused checks aren't tested, so they are never overdue.
+			var overdue float64
+			lastTest := time.Unix(check.LastTestTime, 0)
+			if paused == "false" && time.Since(lastTest) > 2*time.Duration(check.Resolution)*time.Minute {
+				overdue = 1
+			}
+
+			pingdomCheckOverdue.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(overdue)
+		}
+
+		if since := statusSince(check); since > 0 {
+			pingdomCheckStatusSince.WithLabelValues(
+				acc.name,
+				check.Name,
+				check.Hostname,
+			).Set(float64(since))
+		}
+	}
+
+	pingdomChecksTotal.WithLabelValues(acc.name).Set(float64(len(checks)))
+	pingdomTagsTotal.WithLabelValues(acc.name).Set(float64(len(tagNames)))
+
+	if baselineWindow > 0 || enableResponseTimeHistogram {
+		ids := make(map[int]bool, len(scraped))
+		for _, check := range scraped {
+			ids[check.ID] = true
+		}
+		responseTimeBaselines.prune(acc.name, ids)
+		observedResponseTimes.prune(acc.name, ids)
+	}
+	if enableLastError {
+		ids := map[int]bool{}
+		for _, check := range scraped {
+			if check.Status == "down" {
+				ids[check.ID] = true
+			}
+		}
+		lastCheckErrors.prune(acc.name, ids)
+	}
+	pingdomChecksDown.WithLabelValues(acc.name).Set(float64(downChecks))
+	pingdomChecksPaused.WithLabelValues(acc.name).Set(float64(pausedChecks))
+	for checkType, n := range typeChecks {
+		pingdomChecksByType.WithLabelValues(acc.name, checkType).Set(float64(n))
+	}
+
+	return scraped, nil
+}
+
+// slaTarget returns the SLA target in percent held by tag, and whether tag is
+// a valid SLA target tag, e.g. sla:99.9.
+func slaTarget(tag string) (float64, bool) {
+	if slaTagPrefix == "" || !strings.HasPrefix(tag, slaTagPrefix) {
+		return 0, false
+	}
+
+	target, err := strconv.ParseFloat(strings.TrimPrefix(tag, slaTagPrefix), 64)
+	if err != nil || target < 0 || target > 100 {
+		return 0, false
+	}
+	return target, true
+}
+
+// checkGroup returns the group of a check held by the first of its tags with
+// the --group-tag-prefix, e.g. group:payments, or "ungrouped" if it has none.
+func checkGroup(tags []pingdom.CheckResponseTag) string {
+	if groupTagPrefix != "" {
+		for _, tag := range tags {
+			if group := strings.TrimPrefix(tag.Name, groupTagPrefix); group != tag.Name && group != "" {
+				return group
+			}
+		}
+	}
+	return "ungrouped"
+}
+
+// probeRegions returns the region of the probe servers by id, only calling
+// the Pingdom API if one of checks reports the probe of its last test.
+func probeRegions(ctx context.Context, acc account, checks []checkResponse) map[int]string {
+	needed := false
+	for _, check := range checks {
+		if check.LastProbeID != 0 {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	return listProbeRegions(ctx, acc)
+}
+
+// listProbeRegions returns the region of the probe servers by id, or nil if
+// they can't be retrieved.
+func listProbeRegions(ctx context.Context, acc account) map[int]string {
+	probes, err := listProbes(ctx, acc.client, nil)
+	if err != nil {
+		apiLogger(acc, err).Errorln("Error getting probes")
+		return nil
+	}
+
+	regions := make(map[int]string, len(probes))
+	for _, probe := range probes {
+		regions[probe.ID] = probe.Region
+	}
+
+	return regions
+}
+
+// probeRegion returns the region of the probe with the given id, or unknown.
+func probeRegion(regions map[int]string, id int) string {
+	if region, ok := regions[id]; ok && region != "" {
+		return region
+	}
+
+	return "unknown"
+}
+
+// lastErrors caches the last error of the checks that are down, so that
+// the Pingdom API is only called again once they are tested again.
+type lastErrors struct {
+	mutex  sync.Mutex
+	errors map[checkKey]lastError
+}
+
+// lastError is the description of the last failed test of a check, and the
+// time of its last test.
+type lastError struct {
+	desc     string
+	lastTest int64
+}
+
+// lastCheckErrors are the last errors of the checks, with --enable-last-error.
+var lastCheckErrors = &lastErrors{errors: map[checkKey]lastError{}}
+
+// get returns the last error of check, calling the Pingdom API if it was
+// tested since the previous call. The errors are only cached on success, so
+// that the call is retried on the next scrape.
+func (l *lastErrors) get(ctx context.Context, acc account, check checkResponse) string {
+	key := checkKey{account: acc.name, id: check.ID}
+
+	l.mutex.Lock()
+	cached, ok := l.errors[key]
+	l.mutex.Unlock()
+	if ok && cached.lastTest == check.LastTestTime {
+		return cached.desc
+	}
+
+	desc, err := lastCheckError(ctx, acc, check)
+	if err != nil {
+		apiLogger(acc, err).With("check", check.Name).Errorln("Error getting last error")
+		return ""
+	}
+
+	l.mutex.Lock()
+	l.errors[key] = lastError{desc: desc, lastTest: check.LastTestTime}
+	l.mutex.Unlock()
+
+	return desc
+}
+
+// prune drops the last errors of the checks of account whose ids aren't in
+// ids, e.g. the checks that are up again.
+func (l *lastErrors) prune(account string, ids map[int]bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key := range l.errors {
+		if key.account == account && !ids[key.id] {
+			delete(l.errors, key)
+		}
+	}
+}
+
+// lastCheckError returns the description of the last failed test of check,
+// truncated to maxErrorLength, or an empty string if it can't be retrieved.
+func lastCheckError(ctx context.Context, acc account, check checkResponse) (string, error) {
+	results, err := getResults(ctx, acc.client, check.ID, map[string]string{
+		"limit":  "1",
+		"status": "down",
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(results.Results) == 0 {
+		return "", nil
+	}
+
+	desc := results.Results[0].StatusDescLong
+	if desc == "" {
+		desc = results.Results[0].StatusDesc
+	}
+
+	return truncate(desc, maxErrorLength), nil
+}
+
+// joinTags returns the comma-separated tags of the check or transaction with
+// the given name, limited to maxTags tags and maxTagLength runes to bound the
+// cardinality of the tags label.
+func joinTags(acc account, name string, tags []string) string {
+	if maxTags > 0 && len(tags) > maxTags {
+		log.With("account", acc.name).With("name", name).With("tags", len(tags)).Warnln("Too many tags, keeping the first", maxTags)
+		tags = tags[:maxTags]
+	}
+
+	joined := strings.Join(tags, ",")
+	if maxTagLength > 0 && len([]rune(joined)) > maxTagLength {
+		log.With("account", acc.name).With("name", name).Warnln("Tags too long, truncating them to", maxTagLength, "characters")
+		joined = truncate(joined, maxTagLength)
+	}
+
+	return joined
+}
+
+// truncate returns s truncated to at most n runes.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+
+	return s
+}
+
+// writeMetrics gathers the metrics of g and writes them to w in the
+// Prometheus text exposition format.
+func writeMetrics(w io.Writer, g prometheus.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return err
+	}
+
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statusSince returns the time the check got its current status as a Unix
+// timestamp, the end of its last downtime if it is up and its start if it is
+// down, or 0 if it is unknown, e.g. for the checks that were never down.
+func statusSince(check checkResponse) int64 {
+	switch check.Status {
+	case "up":
+		return check.LastDownEnd
+	case "down":
+		return check.LastDownStart
+	default:
+		return 0
+	}
+}
+
+// normalizeHostname returns the host of hostname, without the scheme, port
+// and path of e.g. https://example.com:443/path, or hostname as is if it
+// can't be parsed.
+func normalizeHostname(hostname string) string {
+	raw := hostname
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return hostname
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// targetIP returns hostname if it is an IP address, and an empty string
+// otherwise, Pingdom not returning the address it resolved. Prometheus
+// drops the ip label of the series with an empty value.
+func targetIP(hostname string) string {
+	if net.ParseIP(hostname) == nil {
+		return ""
+	}
+	return hostname
+}
+
+// retrieveAccountMetrics sets the check limit and usage metrics of acc. A
+// failure is logged without affecting pingdom_up.
+func retrieveAccountMetrics(ctx context.Context, acc account) {
+	var usage *credits
+	err := withRetries(ctx, func() (err error) {
+		usage, err = getCredits(ctx, acc.client)
+		return err
+	})
+	if err != nil {
+		apiLogger(acc, err).Errorln("Error getting credits")
+		return
 	}
+
+	pingdomAccountCheckLimit.WithLabelValues(acc.name).Set(float64(usage.CheckLimit))
+	pingdomAccountCheckUsed.WithLabelValues(acc.name).Set(float64(usage.CheckLimit - usage.AvailableChecks))
+}
+
+// retrieveProbeMetrics sets the probe servers of Pingdom, only the active
+// ones with --probes-only-active. A failure is logged without affecting
+// pingdom_up.
+func retrieveProbeMetrics(ctx context.Context, acc account) {
+	var params map[string]string
+	if probesOnlyActive {
+		params = map[string]string{"onlyactive": "true"}
+	}
+
+	var probes []pingdom.ProbeResponse
+	err := withRetries(ctx, func() (err error) {
+		probes, err = listProbes(ctx, acc.client, params)
+		return err
+	})
+	if err != nil {
+		apiLogger(acc, err).Errorln("Error getting probes")
+		return
+	}
+
+	deleteAccountSeries([]accountVec{pingdomProbeInfo}, acc.name)
+	for _, probe := range probes {
+		pingdomProbeInfo.WithLabelValues(
+			acc.name,
+			strconv.Itoa(probe.ID),
+			probe.Country,
+			probe.City,
+			probe.Region,
+			strconv.FormatBool(probe.Active),
+		).Set(1)
+	}
+}
+
+// maintenanceActive returns whether the maintenance window is active at t,
+// taking its recurrence into account.
+func maintenanceActive(window pingdom.MaintenanceResponse, t time.Time) bool {
+	if window.EffectiveTo > 0 && t.After(time.Unix(window.EffectiveTo, 0)) {
+		return false
+	}
+
+	months, days := maintenanceRecurrence(window)
+	for n := 0; ; n++ {
+		from := time.Unix(window.From, 0).AddDate(0, n*months, n*days)
+		to := time.Unix(window.To, 0).AddDate(0, n*months, n*days)
+		if from.After(t) {
+			return false
+		}
+		if !t.After(to) {
+			return true
+		}
+		if months == 0 && days == 0 {
+			return false
+		}
+	}
+}
+
+// maintenanceNextStart returns the start of the first occurrence of the
+// maintenance window after t, or false if it doesn't occur again.
+func maintenanceNextStart(window pingdom.MaintenanceResponse, t time.Time) (time.Time, bool) {
+	months, days := maintenanceRecurrence(window)
+	for n := 0; ; n++ {
+		from := time.Unix(window.From, 0).AddDate(0, n*months, n*days)
+		if window.EffectiveTo > 0 && from.After(time.Unix(window.EffectiveTo, 0)) {
+			return time.Time{}, false
+		}
+		if from.After(t) {
+			return from, true
+		}
+		if months == 0 && days == 0 {
+			return time.Time{}, false
+		}
+	}
+}
+
+// maintenanceRecurrence returns the months and days between two occurrences
+// of the maintenance window, both 0 if it doesn't recur.
+func maintenanceRecurrence(window pingdom.MaintenanceResponse) (months, days int) {
+	every := window.RepeatEvery
+	if every <= 0 {
+		every = 1
+	}
+
+	switch window.RecurrenceType {
+	case "day":
+		days = every
+	case "week":
+		days = 7 * every
+	case "month":
+		months = every
+	}
+
+	return months, days
+}
+
+// credential returns the positional argument at index i, falling back to
+// the key of the configuration when it is not given.
+func credential(config *viper.Viper, args []string, i int, key string) string {
+	if i < len(args) {
+		return args[i]
+	}
+
+	return config.GetString(key)
+}
+
+// metricNamespaceRegexp matches the valid --metric-namespace values, which
+// must be valid metric names themselves.
+var metricNamespaceRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// instanceRegisterer returns registerer, labeling the metrics registered
+// with the --instance-id if set.
+func instanceRegisterer(registerer prometheus.Registerer) prometheus.Registerer {
+	if instanceID == "" {
+		return registerer
+	}
+	return prometheus.WrapRegistererWith(prometheus.Labels{"instance_id": instanceID}, registerer)
+}
+
+// metricsHandler serves the metrics of gatherer in the format negotiated
+// from the Accept header, OpenMetrics included.
+func metricsHandler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		DisableCompression: disableCompression,
+		EnableOpenMetrics:  true,
+	})
+}
+
+// builtinRoutes lists the paths of the endpoints registered by newServeMux
+// besides the metrics, those ending with / matching their subtree.
+var builtinRoutes = []string{"/", "/healthz", "/livez", "/config", "/check", "/reload", adminCheckPrefix, "/debug/pprof/"}
+
+// newServeMux returns the mux of the endpoints of the server, serving the
+// metrics of gatherer under --metrics-path and the configuration of flags
+// under /config. The handlers are registered on their own mux, as importing
+// pprof registers its handlers on http.DefaultServeMux.
+func newServeMux(flags *pflag.FlagSet, c *collector, gatherer prometheus.Gatherer, reload func() error) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// The other paths are routed to / by the mux.
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `<html>
+<head><title>Pingdom Exporter</title></head>
+<body>
+<h1>Pingdom Exporter</h1>
+<p><a href="%s">Metrics</a></p>
+</body>
+</html>
+`, html.EscapeString(metricsPath))
+	})
+	mux.HandleFunc("/healthz", healthHandler)
+	mux.HandleFunc("/livez", liveHandler)
+
+	mux.Handle("/config", withAuth(configHandler(flags, func() map[string]string {
+		var names []string
+		for _, acc := range c.currentAccounts() {
+			names = append(names, acc.name)
+		}
+		return map[string]string{"accounts": strings.Join(names, ",")}
+	})))
+	mux.Handle("/check", withAuth(checkHandler(c.currentAccounts)))
+	mux.Handle("/reload", withAuth(reloadHandler(reload)))
+	if enableAdminAPI {
+		mux.Handle(adminCheckPrefix, withAuth(adminCheckHandler(c.currentAccounts)))
+	}
+	mux.Handle(metricsPath, withAuth(metricsHandler(gatherer)))
+
+	if enablePprof {
+		mux.Handle("/debug/pprof/", withAuth(http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", withAuth(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", withAuth(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", withAuth(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", withAuth(http.HandlerFunc(pprof.Trace)))
+	}
+
+	return mux
 }
 
 func serverRun(cmd *cobra.Command, args []string) {
-	var client *pingdom.Client
-	flag.Parse()
-
-	if len(cmd.Flags().Args()) == 3 {
-		client = pingdom.NewClient(
-			flag.Arg(1),
-			flag.Arg(2),
-			flag.Arg(3),
-		)
-	} else if len(cmd.Flags().Args()) == 4 {
-		client = pingdom.NewMultiUserClient(
-			flag.Arg(1),
-			flag.Arg(2),
-			flag.Arg(3),
-			flag.Arg(4),
-		)
-	} else {
-		_ = cmd.Help()
-		os.Exit(1)
+	accounts := setupAccounts(cmd, args)
+
+	// The flags are validated once the configuration file is read, as it
+	// sets them too.
+	if err := validateServerFlags(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := parseStatusValues(statusValuesFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := disableCheckLabels(); err != nil {
+		log.Fatal(err)
+	}
+
+	// The Go runtime and process metrics of the exporter itself keep their
+	// standard names, without the namespace.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	var registerer prometheus.Registerer = registry
+	if metricNamespace != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(metricNamespace+"_", registry)
+	}
+	c := newCollector(accounts, time.Second*time.Duration(waitSeconds), time.Second*time.Duration(waitJitterSeconds))
+	registerer.MustRegister(c)
+
+	// The scrape metrics are labeled with the instance id, but not the
+	// metrics of the checks and transactions so as not to multiply their
+	// series.
+	if instanceID == "" && instanceIDFromHostname {
+		instanceID = os.Getenv("HOSTNAME")
+	}
+	instanceRegisterer(registerer).MustRegister(metaCollector{c: c})
+	gatherer := c.gatherer(registry)
+
+	// The data requiring a call to the Pingdom API per check is refreshed in
+	// the background every --wait seconds, before the first scrape with
+	// --oneshot or --wait-for-first-scrape.
+	if detailsEnabled() {
+		if oneshot || waitFirstScrape {
+			c.refreshDetails()
+		} else {
+			go c.refreshDetails()
+		}
+		if !oneshot {
+			go c.refreshDetailsLoop(time.Second * time.Duration(waitSeconds))
+		}
 	}
 
+	// With --oneshot, the metrics are pushed instead of printed when a
+	// Pushgateway is set, e.g. for a cron job.
+	if oneshot {
+		if pushGatewayURL != "" {
+			if err := newPusher(gatherer).Push(); err != nil {
+				log.Fatalf("Error pushing the metrics to the Pushgateway: %v", err)
+			}
+		} else if err := writeMetrics(os.Stdout, gatherer); err != nil {
+			log.Fatal(err)
+		}
+		if atomic.LoadInt32(&scrapeState) != scrapeSucceeded {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if pushGatewayURL != "" {
+		go pushLoop(newPusher(gatherer), time.Second*time.Duration(waitSeconds))
+	}
+
+	reload := func() error {
+		return c.reload(func() ([]account, error) {
+			return reloadAccounts(cmd, args)
+		})
+	}
+	mux := newServeMux(cmd.Flags(), c, gatherer, reload)
+
+	headers, err := parseResponseHeaders(responseHeaders)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	addr := fmt.Sprintf(":%d", port)
+	if listenAddress != "" {
+		addr = listenAddress
+	}
+
+	srv := &http.Server{Addr: addr, Handler: withHeaders(mux, headers)}
+	done := make(chan struct{})
+
 	go func() {
-		for {
-			retrieveChecksMetrics(client)
-			retrieveTransactionMetrics(client)
-			sleep()
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+
+		for range hupChan {
+			log.Infoln("Received SIGHUP, reloading")
+			if err := reload(); err != nil {
+				log.With("err", err).Errorln("Error reloading the configuration")
+			}
 		}
 	}()
 
 	go func() {
+		defer close(done)
+
 		intChan := make(chan os.Signal, 1)
 		termChan := make(chan os.Signal, 1)
 
@@ -223,19 +1524,40 @@ func serverRun(cmd *cobra.Command, args []string) {
 		select {
 		case <-intChan:
 			log.Infoln("Received SIGINT, exiting")
-			os.Exit(0)
 		case <-termChan:
 			log.Infoln("Received SIGTERM, exiting")
-			os.Exit(0)
+		}
+
+		// Let the in-flight requests, and the Pingdom scrapes they
+		// triggered, complete before exiting.
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.With("err", err).Errorln("Error shutting down the HTTP server")
 		}
 	}()
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "")
-	})
-	http.Handle("/metrics", promhttp.Handler())
+	useTLS := tlsCertFile != "" && tlsKeyFile != ""
 
-	log.Infoln("Listening on:", port)
+	// The collector caches the metrics of this scrape for --wait seconds,
+	// serving them to the first Prometheus scrape.
+	if waitFirstScrape {
+		log.Infoln("Waiting for the first scrape of the Pingdom API")
+		if _, err := gatherer.Gather(); err != nil {
+			log.With("err", err).Errorln("Error gathering the metrics")
+		}
+	}
+
+	log.Infoln("Listening on:", addr)
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	if useTLS {
+		err = srv.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
 }
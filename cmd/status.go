@@ -0,0 +1,71 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// otherStatus is the key of statusValues used for the statuses of the checks
+// not listed in it, NaN by default so that they are ignored by Prometheus.
+const otherStatus = "other"
+
+// statusValues maps the status of a check to the value of
+// pingdom_uptime_status, and can be overridden with --status-values.
+var statusValues = map[string]float64{
+	"unknown":          0,
+	"paused":           0,
+	"up":               1,
+	"unconfirmed_down": 0,
+	"down":             0,
+	otherStatus:        math.NaN(),
+}
+
+var statusValuesFlag string
+
+// parseStatusValues overrides statusValues with the comma-separated
+// status=value pairs of s.
+func parseStatusValues(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid status value %q, must be status=value", pair)
+		}
+		value, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid status value %q: %v", pair, err)
+		}
+		statusValues[kv[0]] = value
+	}
+
+	return nil
+}
+
+// statusValue returns the value of pingdom_uptime_status for status, and
+// whether status is listed in statusValues.
+func statusValue(status string) (float64, bool) {
+	if value, ok := statusValues[status]; ok && status != otherStatus {
+		return value, true
+	}
+
+	return statusValues[otherStatus], false
+}
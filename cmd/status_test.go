@@ -0,0 +1,74 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseStatusValues(t *testing.T) {
+	defaults := statusValues
+	defer func() { statusValues = defaults }()
+
+	tests := []struct {
+		flag    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{"", map[string]float64{"up": 1, "down": 0, "paused": 0}, false},
+		{"paused=-1", map[string]float64{"up": 1, "paused": -1}, false},
+		{"up=2, down=-2 ,", map[string]float64{"up": 2, "down": -2, "unknown": 0}, false},
+		{"other=-1,maintenance=0.5", map[string]float64{"other": -1, "maintenance": 0.5}, false},
+		{"paused", nil, true},
+		{"paused=none", nil, true},
+	}
+	for _, tt := range tests {
+		statusValues = map[string]float64{}
+		for status, value := range defaults {
+			statusValues[status] = value
+		}
+
+		err := parseStatusValues(tt.flag)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatusValues(%q) error = %v, want error %v", tt.flag, err, tt.wantErr)
+			continue
+		}
+		for status, want := range tt.want {
+			if got := statusValues[status]; got != want {
+				t.Errorf("parseStatusValues(%q): %s = %v, want %v", tt.flag, status, got, want)
+			}
+		}
+	}
+}
+
+func TestStatusValue(t *testing.T) {
+	tests := []struct {
+		status string
+		want   float64
+		listed bool
+	}{
+		{"up", 1, true},
+		{"down", 0, true},
+		{"paused", 0, true},
+		{"maintenance", math.NaN(), false},
+		{otherStatus, math.NaN(), false},
+	}
+	for _, tt := range tests {
+		got, listed := statusValue(tt.status)
+		if got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want)) || listed != tt.listed {
+			t.Errorf("statusValue(%q) = %v, %v, want %v, %v", tt.status, got, listed, tt.want, tt.listed)
+		}
+	}
+}
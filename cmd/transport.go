@@ -0,0 +1,199 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"crypto/tls"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newHTTPTransport returns the transport calling the Pingdom API, tuned with
+// the --http.* flags.
+func newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = httpMaxIdleConnsPerHost
+	transport.IdleConnTimeout = time.Second * time.Duration(httpIdleConnTimeoutSeconds)
+	transport.DisableKeepAlives = httpDisableKeepAlives
+	if httpDisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return transport
+}
+
+// rateLimitRemaining extracts the remaining requests from a Pingdom rate
+// limit header, e.g. "Remaining: 394 Time until reset: 3589".
+var rateLimitRemaining = regexp.MustCompile(`Remaining: (\d+)`)
+
+// rateLimitTransport is an http.RoundTripper recording the Pingdom API rate
+// limits of account returned with each response, and the responses rate
+// limiting it.
+type rateLimitTransport struct {
+	account string
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	setRateLimit(pingdomRateLimitShort.WithLabelValues(t.account), resp.Header.Get("Req-Limit-Short"))
+	setRateLimit(pingdomRateLimitLong.WithLabelValues(t.account), resp.Header.Get("Req-Limit-Long"))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		pingdomRateLimited.WithLabelValues(t.account).Inc()
+	}
+
+	return resp, nil
+}
+
+// setRateLimit sets gauge to the remaining requests of a rate limit header,
+// leaving it untouched if the header is missing or malformed.
+func setRateLimit(gauge prometheus.Gauge, header string) {
+	match := rateLimitRemaining.FindStringSubmatch(header)
+	if match == nil {
+		return
+	}
+
+	remaining, err := strconv.Atoi(match[1])
+	if err != nil {
+		return
+	}
+	gauge.Set(float64(remaining))
+}
+
+// tokenTransport is an http.RoundTripper authenticating the requests to the
+// Pingdom API with a bearer token instead of the legacy credentials set by
+// the Pingdom library.
+type tokenTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Del("App-Key")
+	req.Header.Del("Account-Email")
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	return t.next.RoundTrip(req)
+}
+
+// userAgentTransport is an http.RoundTripper setting the User-Agent of the
+// requests to the Pingdom API, identifying the exporter to Pingdom.
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+
+	return t.next.RoundTrip(req)
+}
+
+// requestsTransport is an http.RoundTripper counting the calls of account to
+// the Pingdom API by endpoint and result.
+type requestsTransport struct {
+	account string
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *requestsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint, _ := req.Context().Value(endpointKey{}).(string)
+
+	resp, err := t.next.RoundTrip(req)
+	result := "success"
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result = "error"
+	}
+	pingdomAPIRequests.WithLabelValues(t.account, endpoint, result).Inc()
+
+	return resp, err
+}
+
+// throttleTransport is an http.RoundTripper limiting the calls of account to
+// the Pingdom API to --api-rate-limit per second with a token bucket, holding
+// up to a second of calls to allow short bursts.
+type throttleTransport struct {
+	account string
+	next    http.RoundTripper
+
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newThrottleTransport(account string, rate float64, next http.RoundTripper) *throttleTransport {
+	burst := math.Max(1, math.Ceil(rate))
+	return &throttleTransport{
+		account: account,
+		next:    next,
+		rate:    rate,
+		burst:   burst,
+		tokens:  burst,
+		last:    time.Now(),
+	}
+}
+
+// reserve takes a token from the bucket at now and returns how long to wait
+// for it to be available.
+func (t *throttleTransport) reserve(now time.Time) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.tokens = math.Min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	t.tokens--
+	if t.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	wait := t.reserve(time.Now())
+	pingdomAPIThrottleWait.WithLabelValues(t.account).Set(wait.Seconds())
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
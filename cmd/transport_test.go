@@ -0,0 +1,49 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestThrottleTransportReserve(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		rate  float64
+		calls []time.Duration
+		want  []time.Duration
+	}{
+		{"burst", 2, []time.Duration{0, 0}, []time.Duration{0, 0}},
+		{"over the burst", 2, []time.Duration{0, 0, 0, 0}, []time.Duration{0, 0, 500 * time.Millisecond, time.Second}},
+		{"refilled", 2, []time.Duration{0, 0, time.Second, time.Second}, []time.Duration{0, 0, 0, 0}},
+		{"partially refilled", 2, []time.Duration{0, 0, 250 * time.Millisecond}, []time.Duration{0, 0, 250 * time.Millisecond}},
+		{"below one per second", 0.5, []time.Duration{0, 0, 2 * time.Second}, []time.Duration{0, 2 * time.Second, 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newThrottleTransport("throttle", tt.rate, http.DefaultTransport)
+			transport.last = start
+
+			for i, at := range tt.calls {
+				if got := transport.reserve(start.Add(at)); got != tt.want[i] {
+					t.Errorf("call %d at %v: got wait %v, want %v", i, at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// validateServerFlags returns an error describing the first invalid value
+// or combination of the flags of the server command, checked before the
+// Pingdom API is scraped or the server started.
+func validateServerFlags() error {
+	if waitSeconds < 0 {
+		return fmt.Errorf("invalid wait %d, must be positive or 0", waitSeconds)
+	}
+	if waitJitterSeconds < 0 {
+		return fmt.Errorf("invalid wait jitter %d, must be positive or 0", waitJitterSeconds)
+	}
+
+	if maxConcurrency <= 0 {
+		return fmt.Errorf("invalid max concurrency %d, must be positive", maxConcurrency)
+	}
+
+	if disableChecks && disableTransactions {
+		return errors.New("both --disable-checks and --disable-transactions are set, there is nothing to scrape")
+	}
+
+	if slaWindowDays <= 0 {
+		return fmt.Errorf("invalid SLA window %d, must be positive", slaWindowDays)
+	}
+	if slaWaitSeconds < 0 {
+		return fmt.Errorf("invalid SLA wait %d, must be positive or 0", slaWaitSeconds)
+	}
+	if performanceWindowHours <= 0 {
+		return fmt.Errorf("invalid performance window %d, must be positive", performanceWindowHours)
+	}
+
+	if maxTags < 0 {
+		return fmt.Errorf("invalid max tags %d, must be positive or 0", maxTags)
+	}
+	if maxTagLength < 0 {
+		return fmt.Errorf("invalid max tag length %d, must be positive or 0", maxTagLength)
+	}
+
+	if maxAuthFailures < 0 {
+		return fmt.Errorf("invalid max auth failures %d, must be positive or 0", maxAuthFailures)
+	}
+	if circuitBreakerThreshold < 0 {
+		return fmt.Errorf("invalid circuit breaker threshold %d, must be positive or 0", circuitBreakerThreshold)
+	}
+	if circuitBreakerSeconds < 0 {
+		return fmt.Errorf("invalid circuit breaker duration %d, must be positive or 0", circuitBreakerSeconds)
+	}
+
+	if baselineWindow < 0 || baselineWindow > maxBaselineWindow {
+		return fmt.Errorf("invalid response time baseline window %d, must be between 0 and %d", baselineWindow, maxBaselineWindow)
+	}
+
+	if metricNamespace != "" && !metricNamespaceRegexp.MatchString(metricNamespace) {
+		return fmt.Errorf("invalid metric namespace %q, must match %s", metricNamespace, metricNamespaceRegexp)
+	}
+
+	if listenAddress != "" {
+		if _, _, err := net.SplitHostPort(listenAddress); err != nil {
+			return fmt.Errorf("invalid listen address %q: %v", listenAddress, err)
+		}
+	} else if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d, must be between 1 and 65535", port)
+	}
+
+	// The mux panics on a duplicate route, and routes the paths without a
+	// leading / to the landing page.
+	if !strings.HasPrefix(metricsPath, "/") {
+		return fmt.Errorf("invalid metrics path %q, must start with /", metricsPath)
+	}
+	for _, route := range builtinRoutes {
+		if metricsPath == route || route != "/" && strings.HasSuffix(route, "/") && strings.HasPrefix(metricsPath, route) {
+			return fmt.Errorf("invalid metrics path %q, already used by the %s endpoint", metricsPath, route)
+		}
+	}
+
+	// Setting only one of the auth flags, or of the TLS flags, would
+	// silently serve the metrics without auth, or over HTTP.
+	if (authUsername == "") != (authPassword == "") {
+		return errors.New("both --web.auth-username and --web.auth-password must be set to enable HTTP Basic Auth")
+	}
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		return errors.New("both --web.tls-cert-file and --web.tls-key-file must be set to serve HTTPS")
+	}
+	if tlsCertFile != "" {
+		for _, file := range []string{tlsCertFile, tlsKeyFile} {
+			if err := checkReadable(file); err != nil {
+				return fmt.Errorf("invalid TLS configuration: %v", err)
+			}
+		}
+	}
+
+	// The admin API changes the checks, it must never be exposed without
+	// authentication.
+	if enableAdminAPI && authUsername == "" {
+		return errors.New("the admin API requires HTTP Basic Auth, set --web.auth-username and --web.auth-password")
+	}
+
+	if _, err := parseResponseHeaders(responseHeaders); err != nil {
+		return err
+	}
+
+	return validatePushFlags()
+}
+
+// validateAccountFlags returns an error describing the first invalid value
+// of the flags configuring the calls to the Pingdom API.
+func validateAccountFlags() error {
+	if scrapeTimeoutSeconds <= 0 {
+		return fmt.Errorf("invalid scrape timeout %d, must be positive", scrapeTimeoutSeconds)
+	}
+	if maxRetries < 0 {
+		return fmt.Errorf("invalid max retries %d, must be positive or 0", maxRetries)
+	}
+	if httpMaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("invalid max idle connections per host %d, must be positive or 0", httpMaxIdleConnsPerHost)
+	}
+	if httpIdleConnTimeoutSeconds < 0 {
+		return fmt.Errorf("invalid idle connection timeout %d, must be positive or 0", httpIdleConnTimeoutSeconds)
+	}
+
+	if apiRateLimit < 0 {
+		return fmt.Errorf("invalid API rate limit %v, must be positive or 0", apiRateLimit)
+	}
+
+	if pageLimit <= 0 {
+		return fmt.Errorf("invalid page limit %d, must be positive", pageLimit)
+	}
+
+	if u, err := url.Parse(apiURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid API URL %q, must be an absolute URL", apiURL)
+	}
+
+	if tagsMatch != "any" && tagsMatch != "all" {
+		return fmt.Errorf("invalid tags match %q, must be any or all", tagsMatch)
+	}
+	if tagsMatch == "all" && !includeTags {
+		return errors.New("--tags-match all requires the tags, can't be used with --include-tags=false")
+	}
+
+	return nil
+}
+
+// validateAccountAPIs returns an error if one of accounts calls a version of
+// the Pingdom API that doesn't support the flags: the users and their checks
+// are only available on the legacy API, and the steps of the transactions on
+// the current one, which requires --api-token.
+func validateAccountAPIs(accounts []accountConfig) error {
+	for _, acc := range accounts {
+		if acc.APIToken != "" {
+			if enableCheckOwners {
+				return fmt.Errorf("account %q uses an API token, but --enable-check-owners requires the users of the legacy Pingdom API", acc.Name)
+			}
+			if userIDs != "" {
+				return fmt.Errorf("account %q uses an API token, but --user-ids requires the users of the legacy Pingdom API", acc.Name)
+			}
+		} else if enableTransactionSteps {
+			return fmt.Errorf("account %q uses the legacy Pingdom API, but --enable-transaction-steps requires an API token", acc.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import "testing"
+
+func TestValidateServerFlags(t *testing.T) {
+	previous := struct {
+		wait, concurrency, window, port int
+		disableChecks, disableTrans     bool
+		namespace, address, user, pass  string
+		path                            string
+		cert, key                       string
+		adminAPI                        bool
+	}{waitSeconds, maxConcurrency, baselineWindow, port, disableChecks, disableTransactions, metricNamespace, listenAddress, authUsername, authPassword, metricsPath, tlsCertFile, tlsKeyFile, enableAdminAPI}
+	reset := func() {
+		waitSeconds, maxConcurrency, baselineWindow, port = previous.wait, previous.concurrency, previous.window, previous.port
+		disableChecks, disableTransactions = previous.disableChecks, previous.disableTrans
+		metricNamespace, listenAddress, authUsername, authPassword = previous.namespace, previous.address, previous.user, previous.pass
+		metricsPath = previous.path
+		tlsCertFile, tlsKeyFile, enableAdminAPI = previous.cert, previous.key, previous.adminAPI
+	}
+	defer reset()
+
+	tests := []struct {
+		name    string
+		set     func()
+		wantErr bool
+	}{
+		{"defaults", func() {}, false},
+		{"negative wait", func() { waitSeconds = -1 }, true},
+		{"no concurrency", func() { maxConcurrency = 0 }, true},
+		{"nothing to scrape", func() { disableChecks, disableTransactions = true, true }, true},
+		{"baseline window too large", func() { baselineWindow = maxBaselineWindow + 1 }, true},
+		{"metric namespace", func() { metricNamespace = "pingdom_prod" }, false},
+		{"invalid metric namespace", func() { metricNamespace = "1pingdom" }, true},
+		{"listen address", func() { listenAddress = "127.0.0.1:9158" }, false},
+		{"invalid listen address", func() { listenAddress = "127.0.0.1" }, true},
+		{"invalid port", func() { port = 65536 }, true},
+		{"metrics path", func() { metricsPath = "/pingdom/metrics" }, false},
+		{"empty metrics path", func() { metricsPath = "" }, true},
+		{"relative metrics path", func() { metricsPath = "metrics" }, true},
+		{"root metrics path", func() { metricsPath = "/" }, true},
+		{"reload metrics path", func() { metricsPath = "/reload" }, true},
+		{"config metrics path", func() { metricsPath = "/config" }, true},
+		{"healthz metrics path", func() { metricsPath = "/healthz" }, true},
+		{"admin metrics path", func() { metricsPath = "/admin/check/metrics" }, true},
+		{"pprof metrics path", func() { metricsPath = "/debug/pprof/metrics" }, true},
+		{"auth", func() { authUsername, authPassword = "admin", "secret" }, false},
+		{"auth without password", func() { authUsername = "admin" }, true},
+		{"TLS without key", func() { tlsCertFile = "cert.pem" }, true},
+		{"unreadable TLS files", func() { tlsCertFile, tlsKeyFile = "missing.pem", "missing.key" }, true},
+		{"admin API without auth", func() { enableAdminAPI = true }, true},
+		{"admin API", func() { enableAdminAPI, authUsername, authPassword = true, "admin", "secret" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer reset()
+			tt.set()
+
+			if err := validateServerFlags(); (err != nil) != tt.wantErr {
+				t.Errorf("validateServerFlags() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAccountAPIs(t *testing.T) {
+	previousOwners, previousUsers, previousSteps := enableCheckOwners, userIDs, enableTransactionSteps
+	defer func() {
+		enableCheckOwners, userIDs, enableTransactionSteps = previousOwners, previousUsers, previousSteps
+	}()
+
+	token := accountConfig{Name: "token", APIToken: "token"}
+	legacy := accountConfig{Name: "legacy", Username: "u", Password: "p", APIKey: "k"}
+
+	tests := []struct {
+		name    string
+		owners  bool
+		users   string
+		steps   bool
+		wantErr bool
+	}{
+		{"defaults", false, "", false, false},
+		{"check owners", true, "", false, true},
+		{"user ids", false, "1,2", false, true},
+		{"transaction steps", false, "", true, true},
+	}
+	for _, tt := range tests {
+		enableCheckOwners, userIDs, enableTransactionSteps = tt.owners, tt.users, tt.steps
+		if err := validateAccountAPIs([]accountConfig{legacy, token}); (err != nil) != tt.wantErr {
+			t.Errorf("validateAccountAPIs() with %s error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	enableCheckOwners, userIDs, enableTransactionSteps = true, "1", false
+	if err := validateAccountAPIs([]accountConfig{legacy}); err != nil {
+		t.Errorf("validateAccountAPIs() of a legacy account with the users error = %v, want nil", err)
+	}
+	enableCheckOwners, userIDs, enableTransactionSteps = false, "", true
+	if err := validateAccountAPIs([]accountConfig{token}); err != nil {
+		t.Errorf("validateAccountAPIs() of a token account with the steps error = %v, want nil", err)
+	}
+}
@@ -15,30 +15,33 @@ package cmd
 
 import (
 	"fmt"
+	"runtime"
 
+	"github.com/prometheus/common/version"
 	"github.com/spf13/cobra"
 )
 
-var (
-	versionCmd = &cobra.Command{
-		Use:   "version",
-		Short: "Print version information",
-		Run:   versionRun,
-	}
-
-	version   string
-	goVersion string
-	gitCommit string
-	osArch    string
-)
+// The version information is set at build time with ldflags, see
+// .promu.yml.
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version information",
+	Run:   versionRun,
+}
 
 func init() {
 	RootCmd.AddCommand(versionCmd)
+
+	RootCmd.Version = version.Version
+	RootCmd.SetVersionTemplate(versionInfo())
 }
 
 func versionRun(cmd *cobra.Command, args []string) {
-	fmt.Printf("Version:\t%v\n", version)
-	fmt.Printf("Go version:\t%v\n", goVersion)
-	fmt.Printf("Git commit:\t%v\n", gitCommit)
-	fmt.Printf("OS/Arch:\t%v\n", osArch)
+	fmt.Print(versionInfo())
+}
+
+// versionInfo returns the version information of the exporter.
+func versionInfo() string {
+	return fmt.Sprintf("Version:\t%v\nGo version:\t%v\nGit commit:\t%v\nOS/Arch:\t%v/%v\n",
+		version.Version, version.GoVersion, version.Revision, runtime.GOOS, runtime.GOARCH)
 }
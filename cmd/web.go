@@ -0,0 +1,96 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// withAuth wraps h with HTTP Basic Auth when both --web.auth-username and
+// --web.auth-password are set.
+func withAuth(h http.Handler) http.Handler {
+	if authUsername == "" || authPassword == "" {
+		return h
+	}
+
+	return basicAuth(h, authUsername, authPassword)
+}
+
+// basicAuth wraps h with HTTP Basic Auth, only allowing requests with the
+// given username and password.
+func basicAuth(h http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || !secureCompare(u, username) || !secureCompare(p, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pingdom_exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// parseResponseHeaders parses the key:value headers of the
+// --web.response-header flag, on top of the default Cache-Control: no-store
+// preventing the metrics from being cached by intermediaries.
+func parseResponseHeaders(headers []string) (http.Header, error) {
+	h := http.Header{}
+	h.Set("Cache-Control", "no-store")
+
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid response header %q, must be key:value", header)
+		}
+		h.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return h, nil
+}
+
+// withHeaders wraps h to set the given headers on all its responses.
+func withHeaders(h http.Handler, headers http.Header) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// secureCompare compares a and b in constant time. They are hashed first so
+// that the comparison doesn't leak their length either.
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// checkReadable returns an error if the file at path can't be read.
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
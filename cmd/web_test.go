@@ -0,0 +1,128 @@
+// Copyright 2019 Veepee.
+// Copyright 2016 Giant Swarm GmbH.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/pflag"
+)
+
+func TestWithAuth(t *testing.T) {
+	defer func(username, password string) {
+		authUsername, authPassword = username, password
+	}(authUsername, authPassword)
+	authUsername, authPassword = "admin", "secret"
+
+	var reloads int
+	mux := newServeMux(pflag.NewFlagSet("test", pflag.ContinueOnError), newCollector(nil, time.Second, 0), prometheus.NewRegistry(), func() error {
+		reloads++
+		return nil
+	})
+
+	credentials := []struct {
+		name     string
+		username string
+		password string
+		set      bool
+		want     int
+	}{
+		{"correct", "admin", "secret", true, http.StatusOK},
+		{"wrong password", "admin", "wrong", true, http.StatusUnauthorized},
+		{"wrong username", "root", "secret", true, http.StatusUnauthorized},
+		{"missing", "", "", false, http.StatusUnauthorized},
+	}
+	endpoints := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/metrics"},
+		{http.MethodGet, "/config"},
+		{http.MethodPost, "/reload"},
+	}
+	for _, endpoint := range endpoints {
+		for _, tt := range credentials {
+			t.Run(endpoint.path+" "+tt.name, func(t *testing.T) {
+				reloads = 0
+				req := httptest.NewRequest(endpoint.method, endpoint.path, nil)
+				if tt.set {
+					req.SetBasicAuth(tt.username, tt.password)
+				}
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+
+				if rec.Code != tt.want {
+					t.Errorf("got %d, want %d", rec.Code, tt.want)
+				}
+				if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("got no WWW-Authenticate header on a 401")
+				}
+				if endpoint.path == "/reload" && (reloads == 1) != (tt.want == http.StatusOK) {
+					t.Errorf("got %d reloads, want one only when authorized", reloads)
+				}
+			})
+		}
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"default", nil, map[string]string{"Cache-Control": "no-store"}, false},
+		{"custom", []string{"X-Frame-Options: DENY", "x-content-type-options:nosniff"}, map[string]string{
+			"Cache-Control":          "no-store",
+			"X-Frame-Options":        "DENY",
+			"X-Content-Type-Options": "nosniff",
+		}, false},
+		{"override", []string{"Cache-Control: private, max-age=0"}, map[string]string{"Cache-Control": "private, max-age=0"}, false},
+		{"value with colon", []string{"Link: <https://example.com>"}, map[string]string{"Link": "<https://example.com>"}, false},
+		{"missing colon", []string{"X-Frame-Options DENY"}, nil, true},
+		{"missing key", []string{": DENY"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := parseResponseHeaders(tt.flags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResponseHeaders(%q) error = %v, want error %v", tt.flags, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The headers are set on the errors as well.
+			for _, code := range []int{http.StatusOK, http.StatusNotFound} {
+				rec := httptest.NewRecorder()
+				withHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(code)
+					fmt.Fprintln(w, "body")
+				}), headers).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+				for key, value := range tt.want {
+					if got := rec.Header().Get(key); got != value {
+						t.Errorf("got %s %q on a %d, want %q", key, got, code, value)
+					}
+				}
+			}
+		})
+	}
+}